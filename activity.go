@@ -0,0 +1,79 @@
+package meteredwriter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NewActivitySelfCleaningHistogram returns SelfCleaningHistogram wrapping
+// specified histogram, which uses activity-based self-cleaning: samples are
+// cleared once delay passes without any Update calls, so histogram updated
+// directly, without Register and Done calls, is never cleared in the middle
+// of activity. Outstanding registrations still prevent cleaning, and Register
+// and ClearNow calls restart idle period. Histogram not updated since it was
+// last cleared is not cleared again, so OnClear callback only fires for
+// cleanings that drop samples. Idle time is checked periodically, so cleaning
+// may happen up to delay later than idle period ends. Non-positive delay is
+// replaced with minActivityDelay.
+func NewActivitySelfCleaningHistogram(histogram Histogram, delay time.Duration) *SelfCleaningHistogram {
+	h := &SelfCleaningHistogram{
+		Histogram:    histogram,
+		c:            make(chan struct{}),
+		q:            make(chan struct{}),
+		activity:     true,
+		lastActivity: time.Now().UnixNano(),
+	}
+	h.start(delay)
+	return h
+}
+
+// decayActivity clears histogram once it is not updated for delay, see
+// NewActivitySelfCleaningHistogram.
+func (h *SelfCleaningHistogram) decayActivity(delay time.Duration, guard chan<- struct{}) {
+	defer close(h.exited)
+	if delay <= 0 {
+		delay = minActivityDelay
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	close(guard)
+	cleared := atomic.LoadInt64(&h.lastActivity) // lastActivity value at the last cleaning
+	var restarted int64                          // time of the last Register or ClearNow call
+	for {
+		select {
+		case <-h.q:
+			return
+		case <-h.c:
+			restarted = time.Now().UnixNano()
+			if !t.Stop() {
+				select {
+				case <-t.C:
+				default:
+				}
+			}
+			t.Reset(delay)
+			continue
+		case <-t.C:
+		}
+		last := atomic.LoadInt64(&h.lastActivity)
+		since := last
+		if restarted > since {
+			since = restarted
+		}
+		idle := time.Since(time.Unix(0, since))
+		switch {
+		case idle < delay:
+			t.Reset(delay - idle)
+			continue
+		case last != cleared && last > atomic.LoadInt64(&h.lastClear) &&
+			atomic.LoadInt64(&h.outstanding) == 0:
+			h.selfClean()
+			cleared = last
+		}
+		t.Reset(delay)
+	}
+}
+
+// minActivityDelay is used by activity-based self-cleaning instead of
+// non-positive delay, which would otherwise make it spin.
+const minActivityDelay = time.Second
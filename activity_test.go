@@ -0,0 +1,85 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestActivitySelfCleaningHistogram(t *testing.T) {
+	sh := NewActivitySelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		100*time.Millisecond)
+	defer sh.Shutdown()
+	cleared := make(chan struct{}, 10)
+	sh.OnClear(func() { cleared <- struct{}{} })
+	t.Log("updating histogram without Register/Done for longer than delay")
+	for i := 0; i < 10; i++ {
+		sh.Update(int64(i))
+		time.Sleep(30 * time.Millisecond)
+	}
+	if cnt := sh.Count(); cnt != 10 {
+		t.Fatal("histogram should not be cleared during activity, got:", cnt)
+	}
+	t.Log("waiting for histogram to clear")
+	time.Sleep(250 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("histogram should be cleared after idle period, got:", cnt)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := len(cleared); n != 1 {
+		t.Fatal("idle histogram should be cleared once, got:", n)
+	}
+	t.Log("outstanding registration should prevent cleaning")
+	sh.Register()
+	sh.Update(1)
+	time.Sleep(250 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 1 {
+		t.Fatal("should have 1 registered sample, got:", cnt)
+	}
+	sh.Done()
+}
+
+func TestActivitySelfCleaningHistogram_ClearNow(t *testing.T) {
+	sh := NewActivitySelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		100*time.Millisecond)
+	defer sh.Shutdown()
+	cleared := make(chan struct{}, 10)
+	sh.OnClear(func() { cleared <- struct{}{} })
+	time.Sleep(250 * time.Millisecond)
+	if n := len(cleared); n != 0 {
+		t.Fatal("histogram never updated should not be cleared, got:", n)
+	}
+	sh.Update(1)
+	time.Sleep(60 * time.Millisecond)
+	sh.ClearNow()
+	time.Sleep(250 * time.Millisecond)
+	if n := len(cleared); n != 0 {
+		t.Fatal("histogram not updated since ClearNow should not be cleared, got:", n)
+	}
+	sh.Update(1)
+	time.Sleep(60 * time.Millisecond)
+	sh.ClearNow()
+	sh.Update(2)
+	time.Sleep(60 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 1 {
+		t.Fatal("ClearNow should restart idle period, got samples:", cnt)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if cnt, n := sh.Count(), len(cleared); cnt != 0 || n != 1 {
+		t.Fatalf("want histogram cleared once, got %d samples, %d cleanings", cnt, n)
+	}
+}
+
+func TestActivitySelfCleaningHistogram_ZeroDelay(t *testing.T) {
+	sh := NewActivitySelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), 0)
+	defer sh.Shutdown()
+	sh.Update(1)
+	time.Sleep(50 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 1 {
+		t.Fatal("non-positive delay should be replaced with minActivityDelay, got samples:", cnt)
+	}
+}
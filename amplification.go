@@ -0,0 +1,77 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// AmplificationMeter links two counting writers placed at the top and at the
+// bottom of a writer chain (e.g. metered writer over buffering/encoding layer
+// over a raw file) and reports write amplification: ratio of bytes hitting
+// the bottom writer to bytes accepted by the top one.
+//
+// Zero value is ready to use.
+type AmplificationMeter struct {
+	top, bottom int64 // updated atomically
+}
+
+// Chain wires a new AmplificationMeter into a writer chain. dst is the bottom
+// writer, layers is called with the bottom counting writer and should return
+// writer stacked over it. Returned writer is the top of the chain; its Close
+// method closes the writer returned by layers if it implements io.Closer.
+func Chain(dst io.Writer, layers func(io.Writer) io.Writer) (io.Writer, *AmplificationMeter) {
+	m := new(AmplificationMeter)
+	bottom := m.Bottom(dst)
+	if layers == nil {
+		return m.Top(bottom), m
+	}
+	return m.Top(layers(bottom)), m
+}
+
+// Top wraps writer counting bytes accepted at the top of the chain.
+func (m *AmplificationMeter) Top(writer io.Writer) io.WriteCloser {
+	return countingWriter{Writer: writer, n: &m.top}
+}
+
+// Bottom wraps writer counting bytes passed to the bottom of the chain.
+func (m *AmplificationMeter) Bottom(writer io.Writer) io.WriteCloser {
+	return countingWriter{Writer: writer, n: &m.bottom}
+}
+
+// TopBytes returns number of bytes accepted at the top of the chain.
+func (m *AmplificationMeter) TopBytes() int64 { return atomic.LoadInt64(&m.top) }
+
+// BottomBytes returns number of bytes passed to the bottom of the chain.
+func (m *AmplificationMeter) BottomBytes() int64 { return atomic.LoadInt64(&m.bottom) }
+
+// Amplification returns write amplification factor, bottomBytes/topBytes. It
+// returns 0 if nothing was written to the top of the chain yet.
+func (m *AmplificationMeter) Amplification() float64 {
+	top := m.TopBytes()
+	if top == 0 {
+		return 0
+	}
+	return float64(m.BottomBytes()) / float64(top)
+}
+
+// countingWriter adds number of bytes written to underlying writer to n.
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	if n > 0 {
+		atomic.AddInt64(w.n, int64(n))
+	}
+	return n, err
+}
+
+// Close closes underlying writer if it implements io.Closer.
+func (w countingWriter) Close() error {
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestChainAmplification(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, m := Chain(buf, func(w io.Writer) io.Writer { return hex.NewEncoder(w) })
+	if a := m.Amplification(); a != 0 {
+		t.Fatal("amplification should be 0 before any writes, got:", a)
+	}
+	if _, err := w.Write([]byte("hello, world")); err != nil {
+		t.Fatal("write error:", err)
+	}
+	t.Logf("top: %d bytes, bottom: %d bytes", m.TopBytes(), m.BottomBytes())
+	if m.TopBytes() != 12 || m.BottomBytes() != int64(buf.Len()) {
+		t.Fatal("unexpected byte counts:", m.TopBytes(), m.BottomBytes())
+	}
+	if a := m.Amplification(); a != 2 {
+		t.Fatal("hex encoding should have amplification of 2, got:", a)
+	}
+}
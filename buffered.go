@@ -0,0 +1,111 @@
+package meteredwriter
+
+import "sync"
+
+// BufferedHistogram wraps shared Histogram, accumulating samples in a local
+// buffer and adding them to wrapped histogram in batches, which reduces
+// contention on wrapped histogram lock when it is updated by many writers.
+// Each writer should use its own BufferedHistogram over the shared one.
+//
+// Buffered samples are not visible in wrapped histogram until flushed, so
+// histogram lags behind by up to flushEvery samples per BufferedHistogram;
+// reading statistics through BufferedHistogram itself flushes its buffer
+// first. BufferedHistogram implements Registrar interface: Done and Shutdown
+// flush the buffer, so closing MeteredWriter using it pushes all samples, and
+// calls are forwarded to wrapped histogram if it implements Registrar.
+type BufferedHistogram struct {
+	h Histogram
+
+	mu  sync.Mutex
+	buf []int64
+}
+
+// NewBufferedHistogram returns BufferedHistogram over h, flushing samples
+// once flushEvery of them are buffered. flushEvery less than 1 is treated as
+// 1, i.e. no buffering.
+func NewBufferedHistogram(h Histogram, flushEvery int) *BufferedHistogram {
+	if flushEvery < 1 {
+		flushEvery = 1
+	}
+	return &BufferedHistogram{h: h, buf: make([]int64, 0, flushEvery)}
+}
+
+// Update buffers sample, flushing buffer if it is full.
+func (b *BufferedHistogram) Update(v int64) {
+	b.mu.Lock()
+	b.buf = append(b.buf, v)
+	if len(b.buf) == cap(b.buf) {
+		b.flush()
+	}
+	b.mu.Unlock()
+}
+
+// Flush adds buffered samples to wrapped histogram.
+func (b *BufferedHistogram) Flush() {
+	b.mu.Lock()
+	b.flush()
+	b.mu.Unlock()
+}
+
+// flush must be called with mu held.
+func (b *BufferedHistogram) flush() {
+	for _, v := range b.buf {
+		b.h.Update(v)
+	}
+	b.buf = b.buf[:0]
+}
+
+// Clear drops buffered samples and clears wrapped histogram.
+func (b *BufferedHistogram) Clear() {
+	b.mu.Lock()
+	b.buf = b.buf[:0]
+	b.mu.Unlock()
+	b.h.Clear()
+}
+
+// Count flushes buffer and returns Count() of wrapped histogram.
+func (b *BufferedHistogram) Count() int64 { b.Flush(); return b.h.Count() }
+
+// Max flushes buffer and returns Max() of wrapped histogram.
+func (b *BufferedHistogram) Max() int64 { b.Flush(); return b.h.Max() }
+
+// Mean flushes buffer and returns Mean() of wrapped histogram.
+func (b *BufferedHistogram) Mean() float64 { b.Flush(); return b.h.Mean() }
+
+// Min flushes buffer and returns Min() of wrapped histogram.
+func (b *BufferedHistogram) Min() int64 { b.Flush(); return b.h.Min() }
+
+// Percentile flushes buffer and returns Percentile() of wrapped histogram.
+func (b *BufferedHistogram) Percentile(p float64) float64 { b.Flush(); return b.h.Percentile(p) }
+
+// Percentiles flushes buffer and returns Percentiles() of wrapped histogram.
+func (b *BufferedHistogram) Percentiles(ps []float64) []float64 {
+	b.Flush()
+	return b.h.Percentiles(ps)
+}
+
+// StdDev flushes buffer and returns StdDev() of wrapped histogram.
+func (b *BufferedHistogram) StdDev() float64 { b.Flush(); return b.h.StdDev() }
+
+// Variance flushes buffer and returns Variance() of wrapped histogram.
+func (b *BufferedHistogram) Variance() float64 { b.Flush(); return b.h.Variance() }
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (b *BufferedHistogram) Register() { register(b.h) }
+
+// Done implements Registrar interface, flushing buffer and forwarding call to
+// wrapped histogram if it implements Registrar.
+func (b *BufferedHistogram) Done() {
+	b.Flush()
+	done(b.h)
+}
+
+// Shutdown implements Registrar interface, flushing buffer and forwarding call
+// to wrapped histogram if it implements Registrar.
+func (b *BufferedHistogram) Shutdown() {
+	b.Flush()
+	if r, ok := b.h.(Registrar); ok {
+		r.Shutdown()
+	}
+}
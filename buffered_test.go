@@ -0,0 +1,56 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestBufferedHistogram(t *testing.T) {
+	const writers, writes = 8, 105
+	shared := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(10000)), time.Minute)
+	defer shared.Shutdown()
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mw := NewMeteredWriter(ioutil.Discard, NewBufferedHistogram(shared, 10))
+			defer mw.Close()
+			for j := 0; j < writes; j++ {
+				mw.Write([]byte("data"))
+			}
+		}()
+	}
+	wg.Wait()
+	if cnt := shared.Count(); cnt != writers*writes {
+		t.Fatalf("all samples should reach shared histogram after Close: want %d, got %d",
+			writers*writes, cnt)
+	}
+	if n := shared.OutstandingRegistrations(); n != 0 {
+		t.Fatal("registrations should be forwarded, outstanding:", n)
+	}
+}
+
+func TestBufferedHistogram_Lag(t *testing.T) {
+	h := metrics.NewHistogram(metrics.NewUniformSample(100))
+	b := NewBufferedHistogram(h, 4)
+	for i := 0; i < 6; i++ {
+		b.Update(int64(i))
+	}
+	if cnt := h.Count(); cnt != 4 {
+		t.Fatal("want one flushed batch of 4 samples, got:", cnt)
+	}
+	if cnt := b.Count(); cnt != 6 {
+		t.Fatal("reading through buffered histogram should flush it, got:", cnt)
+	}
+	b.Update(10)
+	b.Clear()
+	if cnt := b.Count(); cnt != 0 {
+		t.Fatal("Clear should drop buffered samples, got:", cnt)
+	}
+}
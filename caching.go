@@ -0,0 +1,115 @@
+package meteredwriter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// CachingHistogram wraps Histogram, caching results of Percentiles and
+// Percentile calls for a fixed period of time, which saves repeated sorting of
+// sample reservoir by reporting loops querying many idle histograms. Cache is
+// invalidated on each Update and Clear call, so returned values are always
+// consistent with samples added. Clear calls made by wrapped histogram itself,
+// e.g. by self-cleaning timer of SelfCleaningHistogram, bypass CachingHistogram
+// and do not invalidate cache, so values computed before such clear may be
+// returned for up to ttl afterwards.
+//
+// CachingHistogram implements Registrar interface, forwarding calls to wrapped
+// histogram if it implements Registrar.
+type CachingHistogram struct {
+	Histogram
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedPercentiles
+}
+
+type cachedPercentiles struct {
+	values []float64
+	at     time.Time
+}
+
+// NewCachingHistogram returns CachingHistogram wrapping histogram, caching
+// percentiles for ttl.
+func NewCachingHistogram(histogram Histogram, ttl time.Duration) *CachingHistogram {
+	return &CachingHistogram{
+		Histogram: histogram,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// Update adds sample to histogram, invalidating cache.
+func (h *CachingHistogram) Update(v int64) {
+	h.Histogram.Update(v)
+	h.invalidate()
+}
+
+// Clear clears histogram samples, invalidating cache.
+func (h *CachingHistogram) Clear() {
+	h.Histogram.Clear()
+	h.invalidate()
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *CachingHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *CachingHistogram) Done() { done(h.Histogram) }
+
+// Shutdown implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *CachingHistogram) Shutdown() {
+	if r, ok := h.Histogram.(Registrar); ok {
+		r.Shutdown()
+	}
+}
+
+func (h *CachingHistogram) invalidate() {
+	h.mu.Lock()
+	if len(h.cache) > 0 {
+		h.cache = nil
+	}
+	h.mu.Unlock()
+}
+
+// Percentile returns cached Percentile() of wrapped histogram.
+func (h *CachingHistogram) Percentile(p float64) float64 {
+	return h.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns Percentiles() of wrapped histogram, possibly cached.
+// Returned slice must not be modified.
+func (h *CachingHistogram) Percentiles(ps []float64) []float64 {
+	key := percentilesKey(ps)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	if c, ok := h.cache[key]; ok && now.Sub(c.at) < h.ttl {
+		return c.values
+	}
+	// computed under lock, so that concurrent Update invalidates cache only
+	// after values are stored
+	values := h.Histogram.Percentiles(ps)
+	if h.cache == nil {
+		h.cache = make(map[string]cachedPercentiles)
+	}
+	h.cache[key] = cachedPercentiles{values: values, at: now}
+	return values
+}
+
+// percentilesKey returns map key for percentiles slice.
+func percentilesKey(ps []float64) string {
+	b := make([]byte, 0, 8*len(ps))
+	for _, p := range ps {
+		u := math.Float64bits(p)
+		for i := 0; i < 8; i++ {
+			b = append(b, byte(u>>(8*i)))
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,66 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+// percentilesCounter counts Percentiles calls of wrapped histogram.
+type percentilesCounter struct {
+	Histogram
+	calls int
+}
+
+func (h *percentilesCounter) Percentiles(ps []float64) []float64 {
+	h.calls++
+	return h.Histogram.Percentiles(ps)
+}
+
+func TestCachingHistogram(t *testing.T) {
+	clock := newFakeClock()
+	counter := &percentilesCounter{Histogram: metrics.NewHistogram(metrics.NewUniformSample(100))}
+	h := NewCachingHistogram(counter, time.Second)
+	h.now = clock.Now
+	ps := []float64{0.5, 0.9, 0.99}
+	h.Update(100)
+	for i := 0; i < 5; i++ {
+		h.Percentiles(ps)
+	}
+	if counter.calls != 1 {
+		t.Fatal("percentiles should be computed once within ttl, got calls:", counter.calls)
+	}
+	h.Percentile(0.5)
+	if counter.calls != 2 {
+		t.Fatal("different percentiles should be computed separately, got calls:", counter.calls)
+	}
+	h.Update(300)
+	if v := h.Percentiles(ps); v[2] != 300 || counter.calls != 3 {
+		t.Fatalf("Update should invalidate cache: %v, calls: %d", v, counter.calls)
+	}
+	clock.Advance(time.Second)
+	h.Percentiles(ps)
+	if counter.calls != 4 {
+		t.Fatal("percentiles should be recomputed after ttl, got calls:", counter.calls)
+	}
+	h.Clear()
+	if v := h.Percentiles(ps); v[0] != 0 || counter.calls != 5 {
+		t.Fatalf("Clear should invalidate cache: %v, calls: %d", v, counter.calls)
+	}
+}
+
+func TestCachingHistogram_Registrar(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer sh.Shutdown()
+	mw := NewMeteredWriter(ioutil.Discard, NewCachingHistogram(sh, time.Second))
+	if n := sh.OutstandingRegistrations(); n != 1 {
+		t.Fatal("Register should be forwarded to wrapped histogram, got registrations:", n)
+	}
+	mw.Close()
+	if n := sh.OutstandingRegistrations(); n != 0 {
+		t.Fatal("Done should be forwarded to wrapped histogram, got registrations:", n)
+	}
+}
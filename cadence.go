@@ -0,0 +1,78 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// CadenceWriter wraps io.Writer expected to be written to at a fixed interval,
+// like heartbeats, and samples cadence drift: difference between actual gap
+// between starts of consecutive non-empty writes and expected interval.
+// Samples are signed: negative values mean writes came early, positive values
+// mean writes came late. Drift of more than one interval means some beats
+// were missed; such drift is sampled as is, and number of missed beats is
+// added to optional counter.
+type CadenceWriter struct {
+	io.Writer
+	interval time.Duration
+	drift    Histogram
+	missed   Counter
+	now      func() time.Time
+	last     lastTime
+}
+
+// NewCadenceWriter returns CadenceWriter wrapping writer, sampling drift from
+// expected interval in nanoseconds to drift histogram. The first write only
+// starts measurement and is not sampled. If missed counter is not nil, it is
+// incremented by the number of whole intervals skipped between writes. If
+// histogram implements Registrar interface, this would also call its
+// Register() method.
+func NewCadenceWriter(writer io.Writer, interval time.Duration, drift Histogram, missed Counter) *CadenceWriter {
+	register(drift)
+	return &CadenceWriter{
+		Writer:   writer,
+		interval: interval,
+		drift:    drift,
+		missed:   missed,
+		now:      time.Now,
+	}
+}
+
+// Drift returns histogram sampling cadence drift.
+func (w *CadenceWriter) Drift() Histogram { return w.drift }
+
+// Write implements io.Writer interface; for each non-empty write operation
+// except the first one, drift of its start time from expected cadence is
+// sampled.
+func (w *CadenceWriter) Write(p []byte) (n int, err error) {
+	start := w.now()
+	n, err = w.Writer.Write(p)
+	if n == 0 {
+		return n, err
+	}
+	prev := w.last.swap(start)
+	if prev.IsZero() {
+		return n, err
+	}
+	gap := start.Sub(prev)
+	if w.drift != nil {
+		w.drift.Update((gap - w.interval).Nanoseconds())
+	}
+	if w.missed != nil && w.interval > 0 {
+		if beats := int64(gap/w.interval) - 1; beats > 0 {
+			w.missed.Inc(beats)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it. If attached histogram
+// implements Registrar interface, this would call its Done() method.
+func (w *CadenceWriter) Close() error {
+	done(w.drift)
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
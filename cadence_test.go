@@ -0,0 +1,43 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestCadenceWriter(t *testing.T) {
+	clock := newFakeClock()
+	drift := metrics.NewHistogram(metrics.NewUniformSample(100))
+	missed := new(testCounter)
+	w := NewCadenceWriter(ioutil.Discard, time.Second, drift, missed)
+	w.now = clock.Now
+	w.Write([]byte("beat"))
+	if cnt := drift.Count(); cnt != 0 {
+		t.Fatal("first write should not be sampled, got:", cnt)
+	}
+	w.Write(nil) // empty writes are ignored
+	for _, gap := range []time.Duration{
+		time.Second,
+		900 * time.Millisecond,
+		1200 * time.Millisecond,
+		3500 * time.Millisecond, // two missed beats
+	} {
+		clock.Advance(gap)
+		w.Write([]byte("beat"))
+	}
+	if cnt := drift.Count(); cnt != 4 {
+		t.Fatal("want 4 samples, got:", cnt)
+	}
+	if v := drift.Min(); v != (-100 * time.Millisecond).Nanoseconds() {
+		t.Fatal("unexpected min drift:", time.Duration(v))
+	}
+	if v := drift.Max(); v != (2500 * time.Millisecond).Nanoseconds() {
+		t.Fatal("unexpected max drift:", time.Duration(v))
+	}
+	if n := missed.Count(); n != 2 {
+		t.Fatal("want 2 missed beats, got:", n)
+	}
+}
@@ -0,0 +1,35 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+)
+
+// WithRegistrar returns io.Closer which closes c and then calls Done method of
+// r, so that Registrar is released even if c is wrapped by layers which only
+// propagate Close, e.g.:
+//
+//	h.Register()
+//	var c io.Closer = WithRegistrar(newCustomWriter(conn, h), h)
+//
+// WithRegistrar does not call r.Register, it only ties release of registration
+// made by caller to Close. Done is called at most once, no matter how many
+// times Close is called, and even if closing c fails; error of c.Close is
+// returned unchanged. Nil c is allowed.
+func WithRegistrar(c io.Closer, r Registrar) io.Closer {
+	return &registrarCloser{c: c, r: r}
+}
+
+type registrarCloser struct {
+	c    io.Closer
+	r    Registrar
+	once sync.Once
+}
+
+func (rc *registrarCloser) Close() (err error) {
+	if rc.c != nil {
+		err = rc.c.Close()
+	}
+	rc.once.Do(rc.r.Done)
+	return err
+}
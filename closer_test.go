@@ -0,0 +1,28 @@
+package meteredwriter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestWithRegistrar(t *testing.T) {
+	h := &registrarHistogram{Histogram: metrics.NewHistogram(metrics.NewUniformSample(100))}
+	h.Register()
+	errClose := errors.New("close failed")
+	c := &closeWriter{err: errClose}
+	rc := WithRegistrar(c, h)
+	for i := 0; i < 2; i++ {
+		if err := rc.Close(); err != errClose {
+			t.Fatal("want error of wrapped closer, got:", err)
+		}
+	}
+	if c.closed != 2 || h.done != 1 {
+		t.Fatalf("want wrapped closer closed twice and Done called once, got %d and %d",
+			c.closed, h.done)
+	}
+	if err := WithRegistrar(nil, h).Close(); err != nil || h.done != 2 {
+		t.Fatal("nil closer should only release registrar, got:", err)
+	}
+}
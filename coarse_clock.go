@@ -0,0 +1,69 @@
+package meteredwriter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CoarseClock provides approximate current time maintained by a background
+// ticker, so that reading it is a cheap atomic load instead of a time.Now
+// call, which may be expensive on some platforms (e.g. some embedded or WASM
+// targets).
+//
+// Precision of CoarseClock is bounded by its resolution: latencies measured
+// with it may be off by up to resolution (and more if ticker goroutine is not
+// scheduled timely), which makes it unsuitable for measuring sub-millisecond
+// latencies. Times returned carry no monotonic clock reading.
+type CoarseClock struct {
+	now  int64 // unix nanoseconds, updated atomically
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewCoarseClock returns CoarseClock updated every resolution; non-positive
+// resolution is replaced with defaultCoarseResolution. Call its Stop method to
+// release background goroutine once clock is no longer needed.
+func NewCoarseClock(resolution time.Duration) *CoarseClock {
+	if resolution <= 0 {
+		resolution = defaultCoarseResolution
+	}
+	c := &CoarseClock{
+		now:  time.Now().UnixNano(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go c.run(resolution)
+	return c
+}
+
+// defaultCoarseResolution is used by NewCoarseClock instead of non-positive
+// resolution, which time.NewTicker does not accept.
+const defaultCoarseResolution = time.Millisecond
+
+func (c *CoarseClock) run(resolution time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case t := <-ticker.C:
+			atomic.StoreInt64(&c.now, t.UnixNano())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Now returns approximate current time.
+func (c *CoarseClock) Now() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.now))
+}
+
+// Stop stops background goroutine updating clock; clock is frozen once Stop
+// returns. It is safe to call Stop more than once.
+func (c *CoarseClock) Stop() {
+	c.once.Do(func() { close(c.stop) })
+	<-c.done
+}
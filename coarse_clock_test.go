@@ -0,0 +1,53 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredWriter_CoarseClock(t *testing.T) {
+	const resolution = 5 * time.Millisecond
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(sleepWriter{50 * time.Millisecond}, histogram,
+		WithCoarseClock(resolution))
+	if _, err := mw.Write([]byte("data")); err != nil {
+		t.Fatal("write error:", err)
+	}
+	d := time.Duration(histogram.Max())
+	t.Log("coarse latency:", d)
+	if d < 50*time.Millisecond-2*resolution || d > time.Second {
+		t.Fatal("coarse latency is too far from actual:", d)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal("metered writer close error:", err)
+	}
+	frozen := mw.o.now()
+	time.Sleep(3 * resolution)
+	if now := mw.o.now(); !now.Equal(frozen) {
+		t.Fatal("clock should be stopped on Close")
+	}
+	mw.Close()
+}
+
+func TestMeteredWriter_CoarseClockZero(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(sleepWriter{10 * time.Millisecond}, histogram,
+		WithCoarseClock(0))
+	defer mw.Close()
+	if mw.o.stop != nil {
+		t.Fatal("zero resolution should fall back to time.Now")
+	}
+	if _, err := mw.Write([]byte("data")); err != nil {
+		t.Fatal("write error:", err)
+	}
+	if d := time.Duration(histogram.Max()); d < 10*time.Millisecond {
+		t.Fatal("latency is too low:", d)
+	}
+	c := NewCoarseClock(0)
+	defer c.Stop()
+	if c.Now().IsZero() {
+		t.Fatal("clock should report current time")
+	}
+}
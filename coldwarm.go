@@ -0,0 +1,104 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ColdWarmWriter wraps io.Writer and splits write latency samples into two
+// histograms: writes following an idle gap longer than configured threshold
+// (cold writes, e.g. after reconnect or with cold caches) are sampled to one
+// histogram, steady-state (warm) writes to another. Gap is measured from the
+// end of the previous non-empty write to the start of the current one; the
+// first write is always cold.
+type ColdWarmWriter struct {
+	io.Writer
+	cold, warm Histogram
+	idle       time.Duration
+	now        func() time.Time
+	last       lastTime
+}
+
+// NewColdWarmWriter returns ColdWarmWriter wrapping writer. Writes started
+// more than idle after the previous one are sampled to cold histogram, others
+// to warm histogram. If histograms implement Registrar interface, this would
+// also call their Register() methods.
+func NewColdWarmWriter(writer io.Writer, idle time.Duration, cold, warm Histogram) *ColdWarmWriter {
+	register(cold, warm)
+	return &ColdWarmWriter{
+		Writer: writer,
+		cold:   cold,
+		warm:   warm,
+		idle:   idle,
+		now:    time.Now,
+	}
+}
+
+// Cold returns histogram sampling writes following an idle gap.
+func (w *ColdWarmWriter) Cold() Histogram { return w.cold }
+
+// Warm returns histogram sampling steady-state writes.
+func (w *ColdWarmWriter) Warm() Histogram { return w.warm }
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled either to cold or warm histogram. Samples are stored in
+// nanoseconds.
+func (w *ColdWarmWriter) Write(p []byte) (n int, err error) {
+	start := w.now()
+	prev := w.last.load()
+	n, err = w.Writer.Write(p)
+	if n == 0 {
+		return n, err
+	}
+	end := w.now()
+	w.last.store(end)
+	h := w.warm
+	if prev.IsZero() || start.Sub(prev) > w.idle {
+		h = w.cold
+	}
+	if h != nil {
+		h.Update(end.Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it. If attached histograms
+// implement Registrar interface, this would call their Done() methods.
+func (w *ColdWarmWriter) Close() error {
+	done(w.cold, w.warm)
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// lastTime holds time of the last write, it is safe for concurrent use.
+type lastTime struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// load returns stored time, zero if nothing was stored yet.
+func (l *lastTime) load() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.t
+}
+
+// store saves t.
+func (l *lastTime) store(t time.Time) {
+	l.mu.Lock()
+	l.t = t
+	l.mu.Unlock()
+}
+
+// swap saves t, returning previously stored time.
+func (l *lastTime) swap(t time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev := l.t
+	l.t = t
+	return prev
+}
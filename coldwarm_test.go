@@ -0,0 +1,38 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestColdWarmWriter(t *testing.T) {
+	clock := newFakeClock()
+	cold := metrics.NewHistogram(metrics.NewUniformSample(100))
+	warm := metrics.NewHistogram(metrics.NewUniformSample(100))
+	w := NewColdWarmWriter(&slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}},
+		time.Second, cold, warm)
+	w.now = clock.Now
+	for i := 0; i < 3; i++ {
+		w.Write([]byte("data"))
+	}
+	if cold.Count() != 1 || warm.Count() != 2 {
+		t.Fatalf("first write should be cold, others warm; got %d cold, %d warm",
+			cold.Count(), warm.Count())
+	}
+	t.Log("simulating idle period")
+	clock.Advance(2 * time.Second)
+	w.Write([]byte("data"))
+	w.Write([]byte("data"))
+	if cold.Count() != 2 || warm.Count() != 3 {
+		t.Fatalf("write after idle gap should be cold; got %d cold, %d warm",
+			cold.Count(), warm.Count())
+	}
+	if v := cold.Max(); v != time.Millisecond.Nanoseconds() {
+		t.Fatal("unexpected cold write latency:", time.Duration(v))
+	}
+	if w.Cold() != cold || w.Warm() != warm {
+		t.Fatal("accessors should return attached histograms")
+	}
+}
@@ -0,0 +1,111 @@
+package meteredwriter
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// MeteredConn wraps net.Conn, sampling latency of each non-empty Write and
+// Read call to separate histograms. It can also measure round-trip time of
+// request/response protocols: call RequestSent after the last write of each
+// request, and time from that call to the end of the next non-empty Read is
+// sampled to round-trip histogram. Pipelined requests are matched with reads
+// in FIFO order, each non-empty Read completing at most one outstanding
+// request, so for responses spanning multiple reads round-trip time measures
+// time to the first byte of response.
+type MeteredConn struct {
+	net.Conn
+	write, read, rtt Histogram
+	now              func() time.Time
+
+	mu      sync.Mutex
+	pending []time.Time // RequestSent times of outstanding requests
+}
+
+// NewMeteredConn returns MeteredConn wrapping conn, sampling write latency to
+// write histogram, read latency to read histogram and round-trip time to rtt
+// histogram. Any histogram may be nil. If histograms implement Registrar
+// interface, this would also call their Register() methods.
+func NewMeteredConn(conn net.Conn, write, read, rtt Histogram) *MeteredConn {
+	register(write, read, rtt)
+	return &MeteredConn{
+		Conn:  conn,
+		write: write,
+		read:  read,
+		rtt:   rtt,
+		now:   time.Now,
+	}
+}
+
+// WrapConn wraps connection accepted from net.Listener, sampling latency of its
+// writes to writeH and of its reads to readH; either histogram may be nil.
+// Returned connection forwards all other net.Conn methods, like SetDeadline or
+// LocalAddr, to c. It is a shortcut for NewMeteredConn without round-trip
+// histogram.
+func WrapConn(c net.Conn, writeH, readH Histogram) net.Conn {
+	return NewMeteredConn(c, writeH, readH, nil)
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled to write histogram. Samples are stored in nanoseconds.
+func (c *MeteredConn) Write(p []byte) (n int, err error) {
+	start := c.now()
+	n, err = c.Conn.Write(p)
+	if n > 0 && c.write != nil {
+		c.write.Update(c.now().Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Read implements io.Reader interface; each non-empty read operation is timed
+// and sampled to read histogram. If there are outstanding requests marked with
+// RequestSent, the oldest one is completed, sampling its round-trip time.
+// Samples are stored in nanoseconds.
+func (c *MeteredConn) Read(p []byte) (n int, err error) {
+	start := c.now()
+	n, err = c.Conn.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	end := c.now()
+	if c.read != nil {
+		c.read.Update(end.Sub(start).Nanoseconds())
+	}
+	c.mu.Lock()
+	var sent time.Time
+	if len(c.pending) > 0 {
+		sent = c.pending[0]
+		c.pending = c.pending[1:]
+	}
+	c.mu.Unlock()
+	if !sent.IsZero() && c.rtt != nil {
+		c.rtt.Update(end.Sub(sent).Nanoseconds())
+	}
+	return n, err
+}
+
+// RequestSent marks the end of request, so that the next non-empty Read not
+// matched to earlier requests samples its round-trip time.
+func (c *MeteredConn) RequestSent() {
+	t := c.now()
+	c.mu.Lock()
+	c.pending = append(c.pending, t)
+	c.mu.Unlock()
+}
+
+// Pending returns number of requests marked with RequestSent and not yet
+// matched with a Read.
+func (c *MeteredConn) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Close implements io.Closer interface, closing underlying connection. If
+// attached histograms implement Registrar interface, this would call their
+// Done() methods.
+func (c *MeteredConn) Close() error {
+	done(c.write, c.read, c.rtt)
+	return c.Conn.Close()
+}
@@ -0,0 +1,112 @@
+package meteredwriter
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredConn_RoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	clock := newFakeClock()
+	writes := metrics.NewHistogram(metrics.NewUniformSample(100))
+	reads := metrics.NewHistogram(metrics.NewUniformSample(100))
+	rtt := metrics.NewHistogram(metrics.NewUniformSample(100))
+	conn := NewMeteredConn(client, writes, reads, rtt)
+	conn.now = clock.Now
+	defer conn.Close()
+
+	// echo server answering pipelined requests after a delay; sent is closed
+	// once client marked both requests as sent
+	sent := make(chan struct{})
+	go func() {
+		buf := make([]byte, 4)
+		for i := 0; ; i++ {
+			if _, err := io.ReadFull(server, buf); err != nil {
+				return
+			}
+			if i == 1 {
+				// both requests are sent; delay responses
+				<-sent
+				clock.Advance(5 * time.Millisecond)
+				server.Write([]byte("resp"))
+				clock.Advance(time.Millisecond)
+				server.Write([]byte("resp"))
+			}
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		conn.RequestSent()
+	}
+	close(sent)
+	if n := conn.Pending(); n != 2 {
+		t.Fatal("want 2 pending requests, got:", n)
+	}
+	buf := make([]byte, 4)
+	for i := 0; i < 2; i++ {
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := conn.Pending(); n != 0 {
+		t.Fatal("want no pending requests, got:", n)
+	}
+	if writes.Count() != 2 || reads.Count() != 2 {
+		t.Fatalf("want 2 write and 2 read samples, got %d and %d",
+			writes.Count(), reads.Count())
+	}
+	if cnt := rtt.Count(); cnt != 2 {
+		t.Fatal("want 2 round-trip samples, got:", cnt)
+	}
+	t.Logf("round-trip min: %v, max: %v", time.Duration(rtt.Min()), time.Duration(rtt.Max()))
+	if rtt.Min() < (5 * time.Millisecond).Nanoseconds() {
+		t.Fatal("round-trip time too low:", time.Duration(rtt.Min()))
+	}
+	if rtt.Max() != (6 * time.Millisecond).Nanoseconds() {
+		t.Fatal("unexpected round-trip time of the second request:", time.Duration(rtt.Max()))
+	}
+}
+
+func TestWrapConn(t *testing.T) {
+	client, server := net.Pipe()
+	writes := metrics.NewHistogram(metrics.NewUniformSample(100))
+	reads := metrics.NewHistogram(metrics.NewUniformSample(100))
+	conn := WrapConn(server, writes, reads)
+	defer conn.Close()
+	defer client.Close()
+	if conn.LocalAddr() != server.LocalAddr() || conn.RemoteAddr() != server.RemoteAddr() {
+		t.Fatal("addresses should be forwarded to wrapped connection")
+	}
+	go func() {
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(client, buf); err != nil {
+			return
+		}
+		client.Write(buf)
+	}()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo: %q, %v", buf, err)
+	}
+	if writes.Count() != 1 || reads.Count() != 1 {
+		t.Fatalf("want one write and one read sample, got %d and %d", writes.Count(), reads.Count())
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatal("deadline should be forwarded to wrapped connection:", err)
+	}
+	var ne net.Error
+	if _, err := conn.Read(buf); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatal("want timeout error after expired deadline, got:", err)
+	}
+}
@@ -0,0 +1,83 @@
+package meteredwriter
+
+import (
+	"context"
+	"time"
+)
+
+// writeDeadliner is implemented by writers supporting write deadlines, like
+// net.Conn and *os.File.
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// WriteContext writes p to underlying writer like Write does, abandoning write
+// once ctx is done. Cancellation is only supported for underlying writers
+// implementing SetWriteDeadline(time.Time) error method, like net.Conn:
+// deadline of ctx is set as write deadline, and if ctx is cancelled before
+// write completes, write deadline is moved to the past to interrupt it. If
+// WriteContext changed write deadline this way, it resets it to zero value
+// once it returns, so deadline previously set by the caller is lost; if ctx
+// has no deadline and is not cancelled during write, caller's deadline is kept
+// intact. For other writers WriteContext is equivalent to Write, ignoring ctx.
+//
+// Latency of abandoned writes is sampled even if no bytes were written, so
+// that time spent on attempts is not lost; otherwise they are sampled like
+// any other write, e.g. WithMinBytes and WithWarmup options still apply. If write was interrupted because
+// ctx is done, ctx.Err() is returned.
+func (mw MeteredWriter) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	dw, ok := mw.Writer.(writeDeadliner)
+	if !ok {
+		return mw.Write(p)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		if err := dw.SetWriteDeadline(d); err != nil {
+			return 0, err
+		}
+		defer dw.SetWriteDeadline(time.Time{})
+	}
+	if ctx.Done() != nil {
+		stop, exited := make(chan struct{}), make(chan struct{})
+		var interrupted bool
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				interrupted = true
+				dw.SetWriteDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-exited
+			if interrupted {
+				dw.SetWriteDeadline(time.Time{})
+			}
+		}()
+	}
+	start, timed := mw.begin()
+	defer mw.leave()
+	n, err = mw.write(p)
+	mw.end(start, timed, len(p), n, err, err != nil && n == 0)
+	if err != nil {
+		err = contextErr(ctx, err)
+	}
+	return n, err
+}
+
+// contextErr returns ctx.Err() if ctx is done or its deadline has passed,
+// otherwise it returns err unchanged. Deadline is checked explicitly, as write
+// deadline may fire slightly before ctx is marked done.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
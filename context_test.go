@@ -0,0 +1,134 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredWriter_WriteContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(client, histogram)
+	defer mw.Close()
+
+	// nobody reads from server end, so write blocks until deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	n, err := mw.WriteContext(ctx, []byte("data"))
+	if err != context.DeadlineExceeded || n != 0 {
+		t.Fatalf("want context.DeadlineExceeded, got %d, %v", n, err)
+	}
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("abandoned write should be sampled, got:", cnt)
+	}
+	t.Log("abandoned write latency:", time.Duration(histogram.Max()))
+	if histogram.Max() < (50 * time.Millisecond).Nanoseconds() {
+		t.Fatal("abandoned write latency is too low:", time.Duration(histogram.Max()))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := mw.WriteContext(ctx, []byte("data")); err != context.Canceled {
+		t.Fatal("want context.Canceled, got:", err)
+	}
+
+	// write deadline should be reset after WriteContext returns
+	go func() { server.Read(make([]byte, 4)) }()
+	if _, err := mw.WriteContext(context.Background(), []byte("data")); err != nil {
+		t.Fatal("write failed:", err)
+	}
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+}
+
+func TestMeteredWriter_WriteContextEmptyWrites(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(client, histogram, WithEmptyWrites())
+	defer mw.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := mw.WriteContext(ctx, []byte("data")); err != context.Canceled {
+		t.Fatal("want context.Canceled, got:", err)
+	}
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("abandoned write should be sampled once, got:", cnt)
+	}
+
+	histogram.Clear()
+	mw = NewMeteredWriter(client, histogram, WithMinBytes(1))
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := mw.WriteContext(ctx, []byte("data")); err != context.Canceled {
+		t.Fatal("want context.Canceled, got:", err)
+	}
+	if cnt := histogram.Count(); cnt != 0 {
+		t.Fatal("abandoned write should be filtered by WithMinBytes, got:", cnt)
+	}
+}
+
+func TestMeteredWriter_WriteContextFallback(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	buf := new(bytes.Buffer)
+	mw := NewMeteredWriter(buf, histogram)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := mw.WriteContext(ctx, []byte("data")); err != nil || buf.Len() != 4 {
+		t.Fatalf("writer without deadlines should ignore context: %q, %v", buf.String(), err)
+	}
+}
+
+func TestMeteredWriter_WriteContextKeepsDeadline(t *testing.T) {
+	dw := new(deadlineWriter)
+	mw := NewMeteredWriter(dw, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := mw.WriteContext(ctx, []byte("data")); err != nil {
+		t.Fatal("write failed:", err)
+	}
+	if dw.calls != 0 {
+		t.Fatal("write deadline set by caller should be kept, SetWriteDeadline calls:", dw.calls)
+	}
+}
+
+func TestMaxSizeMeteredWriter_WriteContext(t *testing.T) {
+	dw := new(deadlineWriter)
+	w := NewMaxSizeMeteredWriter(dw, nil, 3, nil)
+	if _, err := w.WriteContext(context.Background(), []byte("data")); err != ErrWriteTooLarge {
+		t.Fatal("want ErrWriteTooLarge, got:", err)
+	}
+	if dw.Len() != 0 {
+		t.Fatal("oversized write should not reach writer, got:", dw.String())
+	}
+}
+
+func TestQuotaWriter_WriteContext(t *testing.T) {
+	dw := new(deadlineWriter)
+	w := NewQuotaWriter(dw, nil, 6, RejectOverQuota, nil)
+	if _, err := w.WriteContext(context.Background(), []byte("data")); err != nil {
+		t.Fatal("write within quota failed:", err)
+	}
+	if _, err := w.WriteContext(context.Background(), []byte("data")); err != ErrQuotaExceeded {
+		t.Fatal("want ErrQuotaExceeded, got:", err)
+	}
+	if dw.String() != "data" {
+		t.Fatalf("quota should apply to WriteContext, got %q", dw.String())
+	}
+}
+
+// deadlineWriter is a bytes.Buffer implementing SetWriteDeadline method which
+// counts its calls.
+type deadlineWriter struct {
+	bytes.Buffer
+	calls int
+}
+
+func (w *deadlineWriter) SetWriteDeadline(time.Time) error { w.calls++; return nil }
@@ -0,0 +1,28 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// MeteredCopy copies from src to dst with io.Copy, sampling duration of the
+// whole copy operation to h as a single sample, which suits large transfers
+// where the copy, not each chunk, is the unit of interest. Nothing is sampled
+// if no bytes were copied. Samples are stored in nanoseconds.
+func MeteredCopy(dst io.Writer, src io.Reader, h Histogram) (int64, error) {
+	return MeteredCopyBytes(dst, src, h, nil)
+}
+
+// MeteredCopyBytes is like MeteredCopy, but also increments bytes counter by
+// the number of bytes copied. Either h or bytes may be nil.
+func MeteredCopyBytes(dst io.Writer, src io.Reader, h Histogram, bytes Counter) (int64, error) {
+	start := time.Now()
+	n, err := io.Copy(dst, src)
+	if n > 0 && h != nil {
+		h.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	if n > 0 && bytes != nil {
+		bytes.Inc(n)
+	}
+	return n, err
+}
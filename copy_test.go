@@ -0,0 +1,36 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredCopy(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	data := strings.Repeat("x", 1<<20)
+	dst := new(bytes.Buffer)
+	// hide optional interfaces, so that io.Copy copies in many chunks
+	src := io.LimitReader(strings.NewReader(data), int64(len(data)))
+	n, err := MeteredCopy(writerOnly{dst}, src, histogram)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("unexpected copy result: %d, %v", n, err)
+	}
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("whole copy should produce a single sample, got:", cnt)
+	}
+	copied := new(testCounter)
+	if _, err := MeteredCopyBytes(dst, strings.NewReader("data"), histogram, copied); err != nil {
+		t.Fatal(err)
+	}
+	if copied.Count() != 4 || histogram.Count() != 2 {
+		t.Fatalf("unexpected accounting: %d bytes, %d samples", copied.Count(), histogram.Count())
+	}
+	MeteredCopy(dst, strings.NewReader(""), histogram)
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("empty copy should not be sampled, got:", cnt)
+	}
+}
@@ -0,0 +1,245 @@
+// Package ddsketch provides meteredwriter.Histogram implementation backed by
+// DDSketch, a quantile sketch with relative-error guarantees, which can be
+// exported in DDSketch protobuf format for submission as distribution metrics
+// and merged server-side with other sketches using the same mapping.
+//
+// Sketch uses logarithmic mapping as described in "DDSketch: A fast and
+// fully-mergeable quantile sketch with relative-error guarantees" paper
+// (https://arxiv.org/abs/1908.10693) and implemented by
+// github.com/DataDog/sketches-go: value v > 0 lands into bucket with index
+// floor(log(v)/log(gamma)) where gamma = (1+alpha)/(1-alpha), and each bucket
+// is represented by value gamma^index*(1+alpha), so that any reported
+// percentile is within alpha relative error of the true value.
+package ddsketch
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/artyom/meteredwriter"
+)
+
+var _ meteredwriter.Histogram = (*Sketch)(nil)
+
+// DefaultRelativeAccuracy is relative accuracy used by New.
+const DefaultRelativeAccuracy = 0.01
+
+// Sketch is a DDSketch implementing meteredwriter.Histogram interface.
+// Percentiles are derived from the sketch, while count, minimum, maximum, mean
+// and variance are exact. Sketch is safe for concurrent use.
+type Sketch struct {
+	alpha      float64
+	gamma      float64
+	multiplier float64 // 1/ln(gamma)
+
+	mu       sync.Mutex
+	bins     map[int]uint64
+	zero     uint64 // count of non-positive values
+	count    int64
+	min, max int64
+	sum      float64
+	sumSq    float64
+}
+
+// New returns Sketch with DefaultRelativeAccuracy.
+func New() *Sketch { return NewWithAccuracy(DefaultRelativeAccuracy) }
+
+// NewWithAccuracy returns Sketch with given relative accuracy, which must be in
+// (0, 1) range, otherwise DefaultRelativeAccuracy is used.
+func NewWithAccuracy(alpha float64) *Sketch {
+	if !(alpha > 0 && alpha < 1) {
+		alpha = DefaultRelativeAccuracy
+	}
+	gamma := (1 + alpha) / (1 - alpha)
+	return &Sketch{
+		alpha:      alpha,
+		gamma:      gamma,
+		multiplier: 1 / math.Log(gamma),
+		bins:       make(map[int]uint64),
+	}
+}
+
+// RelativeAccuracy returns relative accuracy of sketch percentiles.
+func (s *Sketch) RelativeAccuracy() float64 { return s.alpha }
+
+func (s *Sketch) index(v int64) int {
+	return int(math.Floor(math.Log(float64(v)) * s.multiplier))
+}
+
+func (s *Sketch) value(index int) float64 {
+	return math.Exp(float64(index)/s.multiplier) * (1 + s.alpha)
+}
+
+// Update adds sample to sketch. Non-positive samples are counted as zeroes.
+func (s *Sketch) Update(v int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v <= 0 {
+		s.zero++
+	} else {
+		s.bins[s.index(v)]++
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += float64(v)
+	s.sumSq += float64(v) * float64(v)
+}
+
+// Clear removes all samples from sketch.
+func (s *Sketch) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bins = make(map[int]uint64)
+	s.zero, s.count, s.min, s.max, s.sum, s.sumSq = 0, 0, 0, 0, 0, 0
+}
+
+// Count returns number of samples in sketch.
+func (s *Sketch) Count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Max returns maximum sample, 0 if sketch is empty.
+func (s *Sketch) Max() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.max
+}
+
+// Min returns minimum sample, 0 if sketch is empty.
+func (s *Sketch) Min() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.min
+}
+
+// Mean returns mean of samples, 0 if sketch is empty.
+func (s *Sketch) Mean() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+// Variance returns variance of samples, 0 if sketch is empty.
+func (s *Sketch) Variance() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0
+	}
+	mean := s.sum / float64(s.count)
+	return math.Max(0, s.sumSq/float64(s.count)-mean*mean)
+}
+
+// StdDev returns standard deviation of samples, 0 if sketch is empty.
+func (s *Sketch) StdDev() float64 { return math.Sqrt(s.Variance()) }
+
+// Percentile returns percentile p (in [0, 1] range) estimated from sketch.
+func (s *Sketch) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns percentiles ps (each in [0, 1] range) estimated from
+// sketch.
+func (s *Sketch) Percentiles(ps []float64) []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]float64, len(ps))
+	if s.count == 0 {
+		return out
+	}
+	keys := s.sortedKeys()
+	for i, p := range ps {
+		switch {
+		case p <= 0:
+			out[i] = float64(s.min)
+			continue
+		case p >= 1:
+			out[i] = float64(s.max)
+			continue
+		}
+		rank := p * float64(s.count-1)
+		cum := float64(s.zero)
+		if cum > rank {
+			continue // zero
+		}
+		for _, k := range keys {
+			cum += float64(s.bins[k])
+			if cum > rank {
+				out[i] = math.Min(math.Max(s.value(k), float64(s.min)), float64(s.max))
+				break
+			}
+		}
+	}
+	return out
+}
+
+// sortedKeys returns bin indexes in ascending order. Must be called with mu
+// held.
+func (s *Sketch) sortedKeys() []int {
+	keys := make([]int, 0, len(s.bins))
+	for k := range s.bins {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler interface, encoding sketch
+// as DDSketch protobuf message (see ddsketch.proto of
+// github.com/DataDog/sketches-go): logarithmic index mapping with sketch gamma
+// and zero index offset, positive values stored as contiguous bin counts, and
+// zero count.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var mapping []byte
+	mapping = appendDouble(mapping, 1, s.gamma)
+	mapping = appendDouble(mapping, 2, 0) // indexOffset
+
+	var store []byte
+	if keys := s.sortedKeys(); len(keys) > 0 {
+		first, last := keys[0], keys[len(keys)-1]
+		counts := make([]byte, 0, 8*(last-first+1))
+		for k := first; k <= last; k++ {
+			counts = binary.LittleEndian.AppendUint64(counts, math.Float64bits(float64(s.bins[k])))
+		}
+		store = appendBytes(store, 2, counts) // contiguousBinCounts, packed
+		store = binary.AppendUvarint(append(store, 3<<3), zigzag(first))
+	}
+
+	var b []byte
+	b = appendBytes(b, 1, mapping)
+	b = appendBytes(b, 2, store)
+	b = appendDouble(b, 4, float64(s.zero))
+	return b, nil
+}
+
+// appendDouble appends protobuf double field.
+func appendDouble(b []byte, field int, v float64) []byte {
+	b = append(b, byte(field<<3|1))
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// appendBytes appends protobuf length-delimited field.
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = append(b, byte(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// zigzag encodes signed integer as protobuf sint32.
+func zigzag(v int) uint64 {
+	return uint64(uint32(int32(v)<<1) ^ uint32(int32(v)>>31))
+}
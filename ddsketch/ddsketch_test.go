@@ -0,0 +1,100 @@
+package ddsketch
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSketchAccuracy(t *testing.T) {
+	for _, alpha := range []float64{0.01, 0.05} {
+		s := NewWithAccuracy(alpha)
+		values := make([]int64, 10000)
+		rnd := rand.New(rand.NewSource(1))
+		for i := range values {
+			// log-normally distributed latencies around 1ms
+			values[i] = int64(math.Exp(rnd.NormFloat64()*2 + 14))
+			s.Update(values[i])
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		ps := []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.999}
+		for i, got := range s.Percentiles(ps) {
+			want := float64(values[int(ps[i]*float64(len(values)-1))])
+			if err := math.Abs(got-want) / want; err > alpha {
+				t.Errorf("alpha %v, percentile %v: want %v, got %v (relative error %v)",
+					alpha, ps[i], want, got, err)
+			}
+		}
+		if s.Count() != int64(len(values)) || s.Min() != values[0] || s.Max() != values[len(values)-1] {
+			t.Fatalf("alpha %v: count, min and max should be exact", alpha)
+		}
+		if p := s.Percentile(1); p != float64(values[len(values)-1]) {
+			t.Fatalf("alpha %v: 100th percentile should equal max, got %v", alpha, p)
+		}
+	}
+}
+
+func TestSketchZeroAndClear(t *testing.T) {
+	s := New()
+	if p := s.Percentile(0.5); p != 0 {
+		t.Fatal("empty sketch percentile should be 0, got:", p)
+	}
+	s.Update(0)
+	s.Update(0)
+	s.Update(100)
+	if p := s.Percentile(0.5); p != 0 {
+		t.Fatal("median should fall into zero bucket, got:", p)
+	}
+	if m := s.Mean(); math.Abs(m-100.0/3) > 1e-9 {
+		t.Fatal("unexpected mean:", m)
+	}
+	s.Clear()
+	if s.Count() != 0 || s.Max() != 0 || s.Mean() != 0 {
+		t.Fatal("cleared sketch should be empty")
+	}
+}
+
+func TestSketchMarshalBinary(t *testing.T) {
+	s := NewWithAccuracy(0.02)
+	for _, v := range []int64{0, 1, 1000, 1000, 1e6} {
+		s.Update(v)
+	}
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mapping: field 1, length 18, gamma as field 1 double
+	if len(b) < 20 || b[0] != 0x0a || b[1] != 18 || b[2] != 0x09 {
+		t.Fatalf("unexpected mapping encoding: % x", b)
+	}
+	if gamma := math.Float64frombits(binary.LittleEndian.Uint64(b[3:])); gamma != s.gamma {
+		t.Fatal("unexpected gamma encoded:", gamma)
+	}
+	// zero count is the last field: field 4 double
+	tail := b[len(b)-9:]
+	if tail[0] != 0x21 || math.Float64frombits(binary.LittleEndian.Uint64(tail[1:])) != 1 {
+		t.Fatalf("unexpected zero count encoding: % x", tail)
+	}
+	// bins of 1, 1000 and 1e6 span contiguous range of indexes
+	store := b[20:]
+	if store[0] != 0x12 {
+		t.Fatalf("unexpected store encoding: % x", store)
+	}
+	_, k := binary.Uvarint(store[1:])
+	counts := store[1+k:]
+	if counts[0] != 0x12 {
+		t.Fatalf("unexpected contiguous bin counts encoding: % x", counts)
+	}
+	n, k := binary.Uvarint(counts[1:])
+	counts = counts[1+k : 1+k+int(n)]
+	var total float64
+	for len(counts) > 0 {
+		total += math.Float64frombits(binary.LittleEndian.Uint64(counts))
+		counts = counts[8:]
+	}
+	if total != 4 {
+		t.Fatal("positive bins should hold 4 values, got:", total)
+	}
+}
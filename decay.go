@@ -0,0 +1,49 @@
+package meteredwriter
+
+import "time"
+
+// DecayStrategy defines what SelfCleaningHistogram does with its samples once
+// self-cleaning period passes, see SetDecayStrategy.
+type DecayStrategy interface {
+	// OnDecay is called by self-cleaning timer with histogram to decay.
+	OnDecay(h Histogram)
+}
+
+// ClearDecay is the default DecayStrategy which clears all samples.
+type ClearDecay struct{}
+
+// OnDecay calls h.Clear.
+func (ClearDecay) OnDecay(h Histogram) { h.Clear() }
+
+// decayBox wraps DecayStrategy so it can be stored in atomic.Value regardless
+// of its concrete type.
+type decayBox struct{ DecayStrategy }
+
+// NewSelfCleaningHistogramStrategy is like NewSelfCleaningHistogram, but
+// decays histogram with s instead of clearing it, see SetDecayStrategy.
+func NewSelfCleaningHistogramStrategy(histogram Histogram, delay time.Duration, s DecayStrategy) *SelfCleaningHistogram {
+	h := NewSelfCleaningHistogram(histogram, delay)
+	h.SetDecayStrategy(s)
+	return h
+}
+
+// SetDecayStrategy makes self-cleaning timer call s.OnDecay instead of
+// clearing histogram, which allows strategies like emitting a snapshot before
+// clearing or partial decay. s is called with SelfCleaningHistogram itself, so
+// that its Clear and Snapshot methods are guarded as usual. Callback set with
+// OnClear is called after s.OnDecay returns. Nil s restores ClearDecay.
+func (h *SelfCleaningHistogram) SetDecayStrategy(s DecayStrategy) {
+	if s == nil {
+		s = ClearDecay{}
+	}
+	h.strategy.Store(decayBox{s})
+}
+
+// decayStrategy returns DecayStrategy set with SetDecayStrategy, or
+// ClearDecay.
+func (h *SelfCleaningHistogram) decayStrategy() DecayStrategy {
+	if b, ok := h.strategy.Load().(decayBox); ok {
+		return b.DecayStrategy
+	}
+	return ClearDecay{}
+}
@@ -0,0 +1,71 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestSelfCleaningHistogram_DefaultDecay(t *testing.T) {
+	sh := NewSelfCleaningHistogramStrategy(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		50*time.Millisecond, nil)
+	defer sh.Shutdown()
+	if _, ok := sh.decayStrategy().(ClearDecay); !ok {
+		t.Fatal("nil strategy should default to ClearDecay")
+	}
+	cleared := make(chan int64, 1)
+	sh.OnClear(func() { cleared <- sh.Count() })
+	sh.Register()
+	sh.Update(100)
+	sh.Done()
+	t.Log("waiting for histogram to decay")
+	select {
+	case cnt := <-cleared:
+		if cnt != 0 {
+			t.Fatal("default strategy should clear samples, count:", cnt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("histogram was not decayed")
+	}
+}
+
+// snapshotDecay is a DecayStrategy sending histogram snapshot to c before
+// clearing it.
+type snapshotDecay struct{ c chan Stats }
+
+func (s snapshotDecay) OnDecay(h Histogram) {
+	s.c <- Snapshot(h)
+	h.Clear()
+}
+
+func TestSelfCleaningHistogram_SnapshotDecay(t *testing.T) {
+	s := snapshotDecay{c: make(chan Stats, 1)}
+	sh := NewSelfCleaningHistogramStrategy(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		50*time.Millisecond, s)
+	defer sh.Shutdown()
+	decayed := make(chan struct{}, 1)
+	sh.OnClear(func() { decayed <- struct{}{} })
+	sh.Register()
+	sh.Update(100)
+	sh.Update(300)
+	sh.Done()
+	t.Log("waiting for histogram to decay")
+	select {
+	case st := <-s.c:
+		if st.Count != 2 || st.Max != 300 {
+			t.Fatal("unexpected snapshot taken before clearing:", st)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("strategy was not called")
+	}
+	<-decayed
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("strategy should have cleared histogram, count:", cnt)
+	}
+	if sh.LifetimeCount() != 2 {
+		t.Fatal("lifetime count should survive decay, got:", sh.LifetimeCount())
+	}
+}
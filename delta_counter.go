@@ -0,0 +1,22 @@
+package meteredwriter
+
+import "sync/atomic"
+
+// DeltaCounter is a Counter which can be read and reset in one atomic
+// operation, which suits pull-based monitoring reporting values accumulated
+// since the previous scrape. Zero value is ready to use. DeltaCounter is safe
+// for concurrent use.
+type DeltaCounter struct {
+	n int64 // updated atomically
+}
+
+// Inc implements Counter interface, adding n to counter.
+func (c *DeltaCounter) Inc(n int64) { atomic.AddInt64(&c.n, n) }
+
+// Count returns current counter value.
+func (c *DeltaCounter) Count() int64 { return atomic.LoadInt64(&c.n) }
+
+// CountAndReset returns current counter value resetting counter to zero.
+// Increments happening concurrently are never lost: each of them is reflected
+// either in the value returned or in the value returned by the next call.
+func (c *DeltaCounter) CountAndReset() int64 { return atomic.SwapInt64(&c.n, 0) }
@@ -0,0 +1,44 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestDeltaCounter_Concurrent(t *testing.T) {
+	const writers, writes = 8, 1000
+	c := new(DeltaCounter)
+	mw := NewMeteredWriter(ioutil.Discard, nil, WithWriteCount(c))
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				mw.Write([]byte("data"))
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() { wg.Wait(); close(finished) }()
+	var total, scrapes int64
+scrape:
+	for {
+		select {
+		case <-finished:
+			break scrape
+		default:
+			total += c.CountAndReset()
+			scrapes++
+		}
+	}
+	total += c.CountAndReset()
+	t.Logf("%d scrapes", scrapes)
+	if total != writers*writes {
+		t.Fatalf("sum of deltas should be %d, got %d", writers*writes, total)
+	}
+	if cnt := c.Count(); cnt != 0 {
+		t.Fatal("counter should be zero after final reset, got:", cnt)
+	}
+}
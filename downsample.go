@@ -0,0 +1,118 @@
+package meteredwriter
+
+import (
+	"sort"
+	"sync"
+)
+
+// DownsamplingHistogram wraps Histogram and, once a threshold number of
+// samples was added, compacts histogram: its samples are replaced with a
+// smaller set of samples taken at evenly spaced percentile positions. This
+// keeps memory bounded while preserving the shape of the distribution much
+// better than clearing it.
+//
+// Compaction resets histogram Count to the number of kept samples, and since
+// kept samples stand for all samples compacted, later samples have relatively
+// higher weight than compacted ones.
+type DownsamplingHistogram struct {
+	Histogram
+	values    func() []int64
+	threshold int
+	target    int
+
+	mu      sync.Mutex
+	pending int // samples held, including ones kept by last compaction
+}
+
+// NewDownsamplingHistogram returns DownsamplingHistogram wrapping histogram;
+// values function should return raw samples of histogram (see
+// NewInterpolatedHistogram). Histogram is compacted to target samples each
+// time it holds threshold samples, counting ones kept by previous compaction,
+// so after compaction it is compacted again once threshold-target samples are
+// added. target is clamped to [2, threshold) range.
+func NewDownsamplingHistogram(histogram Histogram, values func() []int64, threshold, target int) *DownsamplingHistogram {
+	if threshold < 3 {
+		threshold = 3
+	}
+	switch {
+	case target < 2:
+		target = 2
+	case target >= threshold:
+		target = threshold - 1
+	}
+	return &DownsamplingHistogram{
+		Histogram: histogram,
+		values:    values,
+		threshold: threshold,
+		target:    target,
+	}
+}
+
+// Update adds sample to histogram, compacting it if threshold is reached.
+func (h *DownsamplingHistogram) Update(v int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Histogram.Update(v)
+	if h.pending++; h.pending >= h.threshold {
+		h.compact()
+	}
+}
+
+// Clear clears histogram samples.
+func (h *DownsamplingHistogram) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Histogram.Clear()
+	h.pending = 0
+}
+
+// Compact compacts histogram immediately; it is a no-op if histogram holds no
+// more samples than compaction target.
+func (h *DownsamplingHistogram) Compact() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.compact()
+}
+
+// compact must be called with mu held.
+func (h *DownsamplingHistogram) compact() {
+	kept := downsample(h.values(), h.target)
+	if kept == nil {
+		return
+	}
+	h.Histogram.Clear()
+	for _, v := range kept {
+		h.Histogram.Update(v)
+	}
+	h.pending = len(kept)
+}
+
+// downsample returns n values taken at evenly spaced percentile positions of
+// values, including minimum and maximum. It returns nil if there are no more
+// than n values.
+func downsample(values []int64, n int) []int64 {
+	if len(values) <= n {
+		return nil
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	kept := make([]int64, n)
+	last := len(sorted) - 1
+	for i := range kept {
+		kept[i] = sorted[(i*last+(n-1)/2)/(n-1)]
+	}
+	return kept
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *DownsamplingHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *DownsamplingHistogram) Done() { done(h.Histogram) }
+
+// Shutdown implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *DownsamplingHistogram) Shutdown() { shutdownAll(h.Histogram) }
@@ -0,0 +1,43 @@
+package meteredwriter
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestDownsamplingHistogram(t *testing.T) {
+	const threshold, target = 10000, 1001
+	h := metrics.NewHistogram(metrics.NewUniformSample(threshold))
+	dh := NewDownsamplingHistogram(h, h.Sample().Values, threshold, target)
+	rnd := rand.New(rand.NewSource(1))
+	ps := []float64{0.1, 0.5, 0.9, 0.99}
+	for i := 0; i < threshold-1; i++ {
+		dh.Update(int64(math.Exp(rnd.NormFloat64() + 10)))
+	}
+	before := dh.Percentiles(ps)
+	min, max := dh.Min(), dh.Max()
+	dh.Update(int64(math.Exp(10)))
+	if cnt := dh.Count(); cnt != target {
+		t.Fatalf("histogram should be compacted to %d samples, got %d", target, cnt)
+	}
+	if dh.Min() != min || dh.Max() != max {
+		t.Fatal("compaction should preserve minimum and maximum")
+	}
+	for i, got := range dh.Percentiles(ps) {
+		t.Logf("percentile %v: before %.0f, after %.0f", ps[i], before[i], got)
+		if err := math.Abs(got-before[i]) / before[i]; err > 0.05 {
+			t.Errorf("percentile %v not preserved: before %v, after %v", ps[i], before[i], got)
+		}
+	}
+	dh.Compact()
+	if cnt := dh.Count(); cnt != target {
+		t.Fatal("compacting compacted histogram should be a no-op, got:", cnt)
+	}
+}
+
+func TestDownsamplingHistogram_Registrar(t *testing.T) {
+	testRegistrarForwarding(t, func(h Histogram) Histogram { return NewDownsamplingHistogram(h, func() []int64 { return nil }, 10, 5) })
+}
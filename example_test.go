@@ -0,0 +1,32 @@
+package meteredwriter_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/artyom/meteredwriter"
+	"github.com/artyom/metrics"
+)
+
+// This example feeds the same write latency samples to histograms with
+// different lifecycles: one keeps all-time statistics, another one is cleared
+// after a minute of inactivity, and the third one only describes the latest
+// 1000 writes.
+func ExampleMultiHistogram() {
+	lifetime := metrics.NewHistogram(metrics.NewUniformSample(1028))
+	recent := meteredwriter.NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(1028)), time.Minute)
+	defer recent.Shutdown()
+	latest := meteredwriter.NewVolumeCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(1028)), 1000)
+
+	w := meteredwriter.NewMeteredWriter(ioutil.Discard,
+		meteredwriter.NewMultiHistogram(lifetime, recent, latest))
+	defer w.Close()
+	for i := 0; i < 1500; i++ {
+		fmt.Fprintln(w, "hello")
+	}
+	fmt.Println(lifetime.Count(), recent.Count(), latest.Count())
+	// Output: 1500 1500 500
+}
@@ -0,0 +1,52 @@
+// Package expdecay provides histograms backed by exponentially decaying
+// reservoir of github.com/artyom/metrics package, configured for use with
+// meteredwriter.MeteredWriter.
+//
+// Exponentially decaying reservoir keeps a fixed number of samples, favoring
+// recent ones: sample weight grows as exp(alpha*t), so with alpha of 0.015
+// samples of the last 5 minutes dominate. Such histogram reflects recent
+// latency without ever being cleared, so it is usually used instead of
+// meteredwriter.SelfCleaningHistogram, not together with it.
+//
+// It is kept separate from meteredwriter package so that meteredwriter does
+// not depend on metrics package.
+package expdecay
+
+import (
+	"github.com/artyom/meteredwriter"
+	"github.com/artyom/metrics"
+)
+
+var _ meteredwriter.Histogram = metrics.Histogram(nil)
+
+const (
+	// DefaultReservoirSize is reservoir size used by NewDefaultHistogram;
+	// it gives 99.9% confidence level with 5% margin of error assuming
+	// normal distribution.
+	DefaultReservoirSize = 1028
+	// DefaultAlpha is decay factor used by NewDefaultHistogram, it heavily
+	// biases reservoir to the last 5 minutes.
+	DefaultAlpha = 0.015
+)
+
+// NewExpDecayHistogram returns histogram backed by exponentially decaying
+// reservoir of reservoirSize samples with decay factor alpha. Non-positive
+// reservoirSize or alpha is replaced with DefaultReservoirSize or
+// DefaultAlpha respectively. Returned histogram can be passed to
+// meteredwriter.NewMeteredWriter and registered in metrics.Registry.
+func NewExpDecayHistogram(reservoirSize int, alpha float64) metrics.Histogram {
+	if reservoirSize <= 0 {
+		reservoirSize = DefaultReservoirSize
+	}
+	if alpha <= 0 {
+		alpha = DefaultAlpha
+	}
+	return metrics.NewHistogram(metrics.NewExpDecaySample(reservoirSize, alpha))
+}
+
+// NewDefaultHistogram returns histogram backed by exponentially decaying
+// reservoir with DefaultReservoirSize and DefaultAlpha parameters, the same
+// ones metrics.NewTimer uses.
+func NewDefaultHistogram() metrics.Histogram {
+	return NewExpDecayHistogram(DefaultReservoirSize, DefaultAlpha)
+}
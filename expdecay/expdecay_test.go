@@ -0,0 +1,32 @@
+package expdecay
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/artyom/meteredwriter"
+)
+
+func TestNewExpDecayHistogram(t *testing.T) {
+	h := NewExpDecayHistogram(100, 0)
+	mw := meteredwriter.NewMeteredWriter(ioutil.Discard, h)
+	for i := 0; i < 1000; i++ {
+		mw.Write([]byte("data"))
+	}
+	if cnt := h.Count(); cnt != 1000 {
+		t.Fatal("should have 1000 registered samples, got:", cnt)
+	}
+	if size := h.Sample().Size(); size != 100 {
+		t.Fatal("reservoir should be bounded by its size, got:", size)
+	}
+	h = NewDefaultHistogram()
+	for i := int64(0); i < 2*DefaultReservoirSize; i++ {
+		h.Update(i)
+	}
+	if size := h.Sample().Size(); size != DefaultReservoirSize {
+		t.Fatal("unexpected default reservoir size:", size)
+	}
+	if max := h.Max(); max < DefaultReservoirSize {
+		t.Fatal("reservoir should keep recent samples, got max:", max)
+	}
+}
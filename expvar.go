@@ -0,0 +1,28 @@
+package meteredwriter
+
+import "expvar"
+
+// PublishExpvar publishes statistics of h as expvar variable with given name,
+// so it is exposed at /debug/vars. Variable is rendered as JSON object with
+// count, min, max, mean, stddev and p50, p75, p90, p95, p99, p999 percentiles
+// keys, latencies are in nanoseconds; statistics are captured with Snapshot
+// on each read. Like expvar.Publish, it panics if variable with such name is
+// already published.
+func PublishExpvar(name string, h Histogram) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		s := Snapshot(h)
+		return map[string]interface{}{
+			"count":  s.Count,
+			"min":    s.Min,
+			"max":    s.Max,
+			"mean":   s.Mean,
+			"stddev": s.StdDev,
+			"p50":    s.P50,
+			"p75":    s.P75,
+			"p90":    s.P90,
+			"p95":    s.P95,
+			"p99":    s.P99,
+			"p999":   s.P999,
+		}
+	}))
+}
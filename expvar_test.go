@@ -0,0 +1,39 @@
+package meteredwriter
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+// expvarSeq makes names of published variables unique across test runs within
+// one process, e.g. with -count flag, as expvar panics on name reuse.
+var expvarSeq int64
+
+func TestPublishExpvar(t *testing.T) {
+	h := metrics.NewHistogram(metrics.NewUniformSample(100))
+	name := "meteredwriter_test_latency_" + strconv.FormatInt(atomic.AddInt64(&expvarSeq, 1), 10)
+	PublishExpvar(name, h)
+	h.Update(100)
+	h.Update(300)
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatal("variable is not published")
+	}
+	t.Log(v.String())
+	var stats struct {
+		Count    int64
+		Min, Max int64
+		P50      float64
+	}
+	if err := json.Unmarshal([]byte(v.String()), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 2 || stats.Min != 100 || stats.Max != 300 || stats.P50 != 200 {
+		t.Fatalf("unexpected published stats: %+v", stats)
+	}
+}
@@ -0,0 +1,70 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// FactoryMeteredWriter meters writes to destinations chosen per write call,
+// e.g. round-robin across shards. Each Write obtains writer from factory
+// function and samples latency to attached histogram regardless of which
+// writer handled the call.
+//
+// FactoryMeteredWriter does not own writers returned by factory: it never
+// closes them, managing their lifecycle is up to the factory owner.
+type FactoryMeteredWriter struct {
+	factory      func() io.Writer
+	h            Histogram
+	histogramFor func(io.Writer) Histogram
+}
+
+// NewFactoryMeteredWriter returns FactoryMeteredWriter using factory to obtain
+// writer for each write. If histogram implements Registrar interface, this
+// would also call its Register() method.
+func NewFactoryMeteredWriter(factory func() io.Writer, h Histogram) FactoryMeteredWriter {
+	return NewKeyedFactoryMeteredWriter(factory, h, nil)
+}
+
+// NewKeyedFactoryMeteredWriter is like NewFactoryMeteredWriter, but it also
+// samples latency to per-writer histogram returned by histogramFor called
+// with writer obtained from factory; histogramFor may return nil to skip
+// per-writer sampling. Registrar interface of per-writer histograms is not
+// used.
+func NewKeyedFactoryMeteredWriter(factory func() io.Writer, h Histogram, histogramFor func(io.Writer) Histogram) FactoryMeteredWriter {
+	register(h)
+	return FactoryMeteredWriter{
+		factory:      factory,
+		h:            h,
+		histogramFor: histogramFor,
+	}
+}
+
+// Write implements io.Writer interface; it gets writer from factory and times
+// write operation on it. Samples of non-empty writes are stored in
+// nanoseconds.
+func (w FactoryMeteredWriter) Write(p []byte) (n int, err error) {
+	dst := w.factory()
+	start := time.Now()
+	n, err = dst.Write(p)
+	if n == 0 {
+		return n, err
+	}
+	elapsed := time.Now().Sub(start).Nanoseconds()
+	if w.h != nil {
+		w.h.Update(elapsed)
+	}
+	if w.histogramFor != nil {
+		if h := w.histogramFor(dst); h != nil {
+			h.Update(elapsed)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If attached histogram implements
+// Registrar interface, this would call its Done() method. Writers returned by
+// factory are not closed.
+func (w FactoryMeteredWriter) Close() error {
+	done(w.h)
+	return nil
+}
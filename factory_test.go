@@ -0,0 +1,40 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestFactoryMeteredWriter(t *testing.T) {
+	shards := []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+	perShard := map[io.Writer]Histogram{
+		shards[0]: metrics.NewHistogram(metrics.NewUniformSample(100)),
+		shards[1]: metrics.NewHistogram(metrics.NewUniformSample(100)),
+	}
+	var next int
+	factory := func() io.Writer {
+		w := shards[next%len(shards)]
+		next++
+		return w
+	}
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	w := NewKeyedFactoryMeteredWriter(factory, histogram,
+		func(w io.Writer) Histogram { return perShard[w] })
+	for _, s := range []string{"a", "b", "c"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if shards[0].String() != "ac" || shards[1].String() != "b" {
+		t.Fatalf("unexpected shard contents: %q, %q", shards[0], shards[1])
+	}
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+	if c0, c1 := perShard[shards[0]].Count(), perShard[shards[1]].Count(); c0 != 2 || c1 != 1 {
+		t.Fatalf("unexpected per-shard sample counts: %d, %d", c0, c1)
+	}
+}
@@ -0,0 +1,95 @@
+package meteredwriter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatStats renders histogram count, minimum, mean, 50th, 90th, 99th
+// percentiles and maximum on a single line, e.g.:
+//
+//	count=120 min=310µs mean=1.9ms p50=1.2ms p90=3.5ms p99=14ms max=210ms
+//
+// Samples are interpreted as nanoseconds. All latencies are rendered in the
+// same unit (ns, µs, ms or s) picked by histogram maximum, so values are easy
+// to compare at a glance. Latencies above one second are rendered in seconds
+// however large they are, e.g. max=300s for a five minute write.
+func FormatStats(h Histogram) string { return formatStats(Snapshot(h)) }
+
+// FormatStatsUnit is like FormatStats, but interprets samples as values in
+// given unit, e.g. time.Microsecond for histograms of MeteredWriter created
+// with NewMeteredWriterUnit.
+func FormatStatsUnit(h Histogram, unit time.Duration) string {
+	return formatStats(Snapshot(h).Scale(unit))
+}
+
+func formatStats(s Stats) string {
+	if s.Count == 0 {
+		return "count=0"
+	}
+	unit, suffix := displayUnit(float64(s.Max))
+	var b strings.Builder
+	b.WriteString("count=")
+	b.WriteString(strconv.FormatInt(s.Count, 10))
+	for _, f := range []struct {
+		name  string
+		value float64
+	}{
+		{"min", float64(s.Min)},
+		{"mean", s.Mean},
+		{"p50", s.P50},
+		{"p90", s.P90},
+		{"p99", s.P99},
+		{"max", float64(s.Max)},
+	} {
+		b.WriteByte(' ')
+		b.WriteString(f.name)
+		b.WriteByte('=')
+		b.WriteString(formatValue(f.value / float64(unit)))
+		b.WriteString(suffix)
+	}
+	return b.String()
+}
+
+// Format renders histogram summary for logs and test output. It is the same
+// as FormatStats, see there for the layout.
+func Format(h Histogram) string { return FormatStats(h) }
+
+// FormatUnit is like Format, but interprets samples as values in given unit;
+// it is the same as FormatStatsUnit.
+func FormatUnit(h Histogram, unit time.Duration) string { return FormatStatsUnit(h, unit) }
+
+// String renders statistics in FormatStats layout.
+func (s Stats) String() string { return formatStats(s) }
+
+// displayUnit returns the largest unit (up to a second) not exceeding v
+// nanoseconds and its suffix.
+func displayUnit(v float64) (time.Duration, string) {
+	switch {
+	case v >= float64(time.Second):
+		return time.Second, "s"
+	case v >= float64(time.Millisecond):
+		return time.Millisecond, "ms"
+	case v >= float64(time.Microsecond):
+		return time.Microsecond, "µs"
+	}
+	return time.Nanosecond, "ns"
+}
+
+// formatValue formats v with about three significant digits, dropping
+// trailing zeroes.
+func formatValue(v float64) string {
+	prec := 2
+	switch {
+	case v >= 100:
+		prec = 0
+	case v >= 10:
+		prec = 1
+	}
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
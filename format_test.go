@@ -0,0 +1,50 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestFormatStats(t *testing.T) {
+	for _, tc := range []struct {
+		samples []time.Duration
+		want    string
+	}{
+		{nil, "count=0"},
+		{[]time.Duration{500, 500},
+			"count=2 min=500ns mean=500ns p50=500ns p90=500ns p99=500ns max=500ns"},
+		{[]time.Duration{1500, 1500, 1500},
+			"count=3 min=1.5µs mean=1.5µs p50=1.5µs p90=1.5µs p99=1.5µs max=1.5µs"},
+		{[]time.Duration{300 * time.Microsecond, 14 * time.Millisecond},
+			"count=2 min=0.3ms mean=7.15ms p50=7.15ms p90=14ms p99=14ms max=14ms"},
+		{[]time.Duration{210 * time.Millisecond, 30 * time.Second},
+			"count=2 min=0.21s mean=15.1s p50=15.1s p90=30s p99=30s max=30s"},
+	} {
+		h := metrics.NewHistogram(metrics.NewUniformSample(100))
+		for _, d := range tc.samples {
+			h.Update(d.Nanoseconds())
+		}
+		if got := FormatStats(h); got != tc.want {
+			t.Errorf("want %q, got %q", tc.want, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	h := metrics.NewHistogram(metrics.NewUniformSample(100))
+	if got := Format(h); got != "count=0" {
+		t.Fatalf("unexpected empty histogram summary: %q", got)
+	}
+	for _, d := range []time.Duration{1500, 2 * time.Millisecond, 2 * time.Millisecond} {
+		h.Update(d.Nanoseconds())
+	}
+	want := FormatStats(h)
+	if got := Format(h); got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+	if got := Snapshot(h).String(); got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
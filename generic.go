@@ -0,0 +1,54 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// TypedMeteredWriter is like MeteredWriter, but keeps concrete type of
+// attached histogram, so that callers can get it back with Histogram method
+// and call type-specific methods without type assertions. Options are not
+// supported; use MeteredWriter for them.
+type TypedMeteredWriter[H Histogram] struct {
+	io.Writer
+	h H
+}
+
+// NewTypedMeteredWriter attaches provided histogram to writer as
+// NewMeteredWriter does, preserving its concrete type; it is a separate
+// function as generic NewMeteredWriter would break existing callers. Unlike
+// NewMeteredWriter, h must not be nil. If histogram implements Registrar
+// interface, this would also call its Register() method.
+//
+// Note that the compiler shares one instantiation between all pointer
+// types, so calls to h are not necessarily devirtualized; see
+// BenchmarkTypedMeteredWriter for the difference it makes.
+func NewTypedMeteredWriter[H Histogram](writer io.Writer, h H) TypedMeteredWriter[H] {
+	register(h)
+	return TypedMeteredWriter[H]{Writer: writer, h: h}
+}
+
+// Histogram returns attached histogram.
+func (mw TypedMeteredWriter[H]) Histogram() H { return mw.h }
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled in attached histogram. Samples are stored in nanoseconds.
+func (mw TypedMeteredWriter[H]) Write(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = mw.Writer.Write(p)
+	if n > 0 {
+		mw.h.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it. If attached histogram
+// also implements Registrar interface, this would call its Done() method.
+func (mw TypedMeteredWriter[H]) Close() error {
+	done(mw.h)
+	if c, ok := mw.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
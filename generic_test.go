@@ -0,0 +1,49 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestTypedMeteredWriter(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer sh.Shutdown()
+	mw := NewTypedMeteredWriter(ioutil.Discard, sh)
+	mw.Write([]byte("data"))
+	mw.Write(nil)
+	// LifetimeCount is specific to SelfCleaningHistogram
+	if cnt := mw.Histogram().LifetimeCount(); cnt != 1 {
+		t.Fatal("should have 1 registered sample, got:", cnt)
+	}
+	if n := sh.OutstandingRegistrations(); n != 1 {
+		t.Fatal("histogram should be registered, got registrations:", n)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := sh.OutstandingRegistrations(); n != 0 {
+		t.Fatal("histogram should be released on close, got registrations:", n)
+	}
+}
+
+func BenchmarkTypedMeteredWriter(b *testing.B) {
+	p := []byte("x")
+	b.Run("generic", func(b *testing.B) {
+		mw := NewTypedMeteredWriter(ioutil.Discard, metrics.NewHistogram(metrics.NewUniformSample(1028)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mw.Write(p)
+		}
+	})
+	b.Run("interface", func(b *testing.B) {
+		mw := NewMeteredWriter(ioutil.Discard, metrics.NewHistogram(metrics.NewUniformSample(1028)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mw.Write(p)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+// fakeClock is a manually advanced clock for deterministic latency tests.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2014, time.June, 5, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// slowWriter accepts all writes, advancing clock by the next configured delay
+// on each call; the last delay is reused once delays are exhausted.
+type slowWriter struct {
+	clock  *fakeClock
+	delays []time.Duration
+	calls  int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	if len(w.delays) > 0 {
+		i := w.calls
+		if i >= len(w.delays) {
+			i = len(w.delays) - 1
+		}
+		w.clock.Advance(w.delays[i])
+	}
+	w.calls++
+	return len(p), nil
+}
+
+// testCounter is a Counter implementation safe for concurrent use.
+type testCounter struct{ n int64 }
+
+func (c *testCounter) Inc(n int64)  { atomic.AddInt64(&c.n, n) }
+func (c *testCounter) Count() int64 { return atomic.LoadInt64(&c.n) }
+
+// shortWriter accepts at most max bytes on each write without reporting an
+// error.
+type shortWriter struct{ max int }
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		return w.max, nil
+	}
+	return len(p), nil
+}
+
+// errWriter writes up to n bytes of each buffer and returns err.
+type errWriter struct {
+	n   int
+	err error
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	if len(p) < w.n {
+		return len(p), w.err
+	}
+	return w.n, w.err
+}
+
+// testMeter is a Meter implementation only tracking count.
+type testMeter struct{ n int64 }
+
+func (m *testMeter) Count() int64      { return atomic.LoadInt64(&m.n) }
+func (m *testMeter) Mark(n int64)      { atomic.AddInt64(&m.n, n) }
+func (m *testMeter) Rate1() float64    { return 0 }
+func (m *testMeter) Rate5() float64    { return 0 }
+func (m *testMeter) Rate15() float64   { return 0 }
+func (m *testMeter) RateMean() float64 { return 0 }
+
+// closeWriter discards writes and returns err on Close.
+type closeWriter struct {
+	closed int
+	err    error
+}
+
+func (w *closeWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *closeWriter) Close() error                { w.closed++; return w.err }
+
+// testGauge is a Gauge implementation safe for concurrent use, keeping the
+// last and the maximum values.
+type testGauge struct{ v, max int64 }
+
+func (g *testGauge) Update(v int64) {
+	atomic.StoreInt64(&g.v, v)
+	for {
+		max := atomic.LoadInt64(&g.max)
+		if v <= max || atomic.CompareAndSwapInt64(&g.max, max, v) {
+			return
+		}
+	}
+}
+func (g *testGauge) Value() int64 { return atomic.LoadInt64(&g.v) }
+func (g *testGauge) Max() int64   { return atomic.LoadInt64(&g.max) }
+
+// sleepWriter sleeps for d on each write.
+type sleepWriter struct{ d time.Duration }
+
+func (w sleepWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.d)
+	return len(p), nil
+}
+
+// panicWriter panics on every write.
+type panicWriter struct{}
+
+func (panicWriter) Write([]byte) (int, error) { panic("write failed") }
+
+// registrarHistogram is a Histogram implementing Registrar interface which
+// counts calls of its methods.
+type registrarHistogram struct {
+	Histogram
+	registered, done, shutdown int
+}
+
+func (h *registrarHistogram) Register() { h.registered++ }
+func (h *registrarHistogram) Done()     { h.done++ }
+func (h *registrarHistogram) Shutdown() { h.shutdown++ }
+
+// testRegistrarForwarding checks that histogram returned by wrap forwards
+// Registrar calls to wrapped SelfCleaningHistogram when used by MeteredWriter.
+func testRegistrarForwarding(t *testing.T, wrap func(Histogram) Histogram) {
+	t.Helper()
+	sh := NewSelfCleaningHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	h := wrap(sh)
+	mw := NewMeteredWriter(ioutil.Discard, h)
+	if n := sh.OutstandingRegistrations(); n != 1 {
+		t.Fatal("Register should be forwarded to wrapped histogram, registrations:", n)
+	}
+	mw.Close()
+	if n := sh.OutstandingRegistrations(); n != 0 {
+		t.Fatal("Done should be forwarded to wrapped histogram, registrations:", n)
+	}
+	r, ok := h.(Registrar)
+	if !ok {
+		t.Fatalf("%T does not implement Registrar", h)
+	}
+	r.Shutdown()
+	if atomic.LoadInt32(&sh.closed) == 0 {
+		t.Fatal("Shutdown should be forwarded to wrapped histogram")
+	}
+}
@@ -0,0 +1,82 @@
+package meteredwriter
+
+import "net/http"
+
+// MeteredResponseWriter wraps http.ResponseWriter and samples latency of each
+// non-empty response body write to attached histogram. See
+// NewMeteredResponseWriter.
+type MeteredResponseWriter struct {
+	http.ResponseWriter
+	mw MeteredWriter
+}
+
+// NewMeteredResponseWriter returns http.ResponseWriter wrapping w, sampling
+// latency of response body writes to h. Returned value implements
+// http.Flusher, http.Hijacker and http.Pusher interfaces only if w does, so
+// that handlers checking for them keep working. It is always a
+// *MeteredResponseWriter, possibly embedded in a type with extra methods, and
+// implements Unwrap method used by http.ResponseController.
+//
+// Since http.ResponseWriter has no Close method, Register() and Done() methods
+// of histograms implementing Registrar interface are not called; call them
+// around request handling if needed.
+func NewMeteredResponseWriter(w http.ResponseWriter, h Histogram) http.ResponseWriter {
+	var r Recorder
+	if h != nil {
+		r = HistogramRecorder(h)
+	}
+	mrw := &MeteredResponseWriter{ResponseWriter: w, mw: NewRecordingWriter(w, r)}
+	f, isFlusher := w.(http.Flusher)
+	hj, isHijacker := w.(http.Hijacker)
+	p, isPusher := w.(http.Pusher)
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*MeteredResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{mrw, f, hj, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*MeteredResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{mrw, f, hj}
+	case isFlusher && isPusher:
+		return struct {
+			*MeteredResponseWriter
+			http.Flusher
+			http.Pusher
+		}{mrw, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*MeteredResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{mrw, hj, p}
+	case isFlusher:
+		return struct {
+			*MeteredResponseWriter
+			http.Flusher
+		}{mrw, f}
+	case isHijacker:
+		return struct {
+			*MeteredResponseWriter
+			http.Hijacker
+		}{mrw, hj}
+	case isPusher:
+		return struct {
+			*MeteredResponseWriter
+			http.Pusher
+		}{mrw, p}
+	}
+	return mrw
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled in attached histogram. Samples are stored in nanoseconds.
+func (w *MeteredResponseWriter) Write(p []byte) (int, error) { return w.mw.Write(p) }
+
+// Unwrap returns underlying http.ResponseWriter.
+func (w *MeteredResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,63 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredResponseWriter(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = NewMeteredResponseWriter(w, histogram)
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("wrapped writer should implement http.Flusher")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("wrapped writer should implement http.Hijacker")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello, "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || string(body) != "hello, world" {
+		t.Fatalf("unexpected response: %d %q", resp.StatusCode, body)
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+}
+
+func TestMeteredResponseWriter_Interfaces(t *testing.T) {
+	// httptest.ResponseRecorder only implements http.Flusher
+	w := NewMeteredResponseWriter(httptest.NewRecorder(), nil)
+	if _, ok := w.(http.Flusher); !ok {
+		t.Fatal("wrapped writer should implement http.Flusher")
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		t.Fatal("wrapped writer should not implement http.Hijacker")
+	}
+	if _, ok := w.(http.Pusher); ok {
+		t.Fatal("wrapped writer should not implement http.Pusher")
+	}
+	if _, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok {
+		t.Fatal("wrapped writer should implement Unwrap")
+	}
+	w.Write([]byte("data"))
+}
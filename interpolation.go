@@ -0,0 +1,130 @@
+package meteredwriter
+
+import (
+	"math"
+	"sort"
+)
+
+// Interpolation selects method used to estimate percentiles from raw samples.
+type Interpolation int
+
+const (
+	// NearestRank returns the smallest sample such that at least p fraction
+	// of samples are less than or equal to it; no interpolation is done.
+	NearestRank Interpolation = iota
+	// Linear interpolates between two closest ranks, with rank of p
+	// computed as p*(N-1). This is the default method of many statistics
+	// packages.
+	Linear
+	// Midpoint returns mean of two closest ranks, with rank of p computed
+	// as p*(N-1).
+	Midpoint
+)
+
+// InterpolatedHistogram wraps Histogram computing percentiles from its raw
+// samples with selected interpolation method, which is useful to match values
+// reported by other systems. Other methods are passed to wrapped histogram,
+// including Registrar ones if wrapped histogram implements it.
+type InterpolatedHistogram struct {
+	Histogram
+	values func() []int64
+	method Interpolation
+}
+
+// NewInterpolatedHistogram returns InterpolatedHistogram wrapping histogram;
+// values function should return raw samples of histogram, e.g. for
+// metrics.Histogram:
+//
+//	h := metrics.NewHistogram(metrics.NewUniformSample(1028))
+//	ih := NewInterpolatedHistogram(h, h.Sample().Values, NearestRank)
+func NewInterpolatedHistogram(histogram Histogram, values func() []int64, method Interpolation) *InterpolatedHistogram {
+	return &InterpolatedHistogram{
+		Histogram: histogram,
+		values:    values,
+		method:    method,
+	}
+}
+
+// Percentile returns percentile p (in [0, 1] range) of histogram samples.
+func (h *InterpolatedHistogram) Percentile(p float64) float64 {
+	return h.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns percentiles ps (each in [0, 1] range) of histogram
+// samples.
+func (h *InterpolatedHistogram) Percentiles(ps []float64) []float64 {
+	return Percentiles(h.values(), ps, h.method)
+}
+
+// Percentiles returns percentiles ps (each in [0, 1] range) of values
+// estimated with given interpolation method. Values slice is not modified. If
+// values is empty, all percentiles are zero. Percentile of NaN p is NaN.
+func Percentiles(values []int64, ps []float64, method Interpolation) []float64 {
+	out := make([]float64, len(ps))
+	if len(values) == 0 {
+		return out
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	last := len(sorted) - 1
+	for i, p := range ps {
+		switch {
+		case math.IsNaN(p):
+			out[i] = math.NaN()
+			continue
+		case p <= 0:
+			out[i] = float64(sorted[0])
+			continue
+		case p >= 1:
+			out[i] = float64(sorted[last])
+			continue
+		}
+		switch method {
+		case NearestRank:
+			out[i] = float64(sorted[nearestRank(p, len(sorted))-1])
+		case Midpoint:
+			pos := p * float64(last)
+			lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+			out[i] = (float64(sorted[lo]) + float64(sorted[hi])) / 2
+		default:
+			pos := p * float64(last)
+			lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+			out[i] = float64(sorted[lo]) + (pos-float64(lo))*float64(sorted[hi]-sorted[lo])
+		}
+	}
+	return out
+}
+
+// rankEpsilon is a tolerance within which p*N is considered integer, so that
+// floating point error does not push nearest rank up, e.g. 0.07*100 is
+// 7.000000000000001.
+const rankEpsilon = 1e-9
+
+// nearestRank returns 1-based nearest rank of percentile p among n samples.
+func nearestRank(p float64, n int) int {
+	x := p * float64(n)
+	if r := math.Round(x); math.Abs(x-r) < rankEpsilon {
+		x = r
+	}
+	rank := int(math.Ceil(x))
+	switch {
+	case rank < 1:
+		return 1
+	case rank > n:
+		return n
+	}
+	return rank
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *InterpolatedHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *InterpolatedHistogram) Done() { done(h.Histogram) }
+
+// Shutdown implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *InterpolatedHistogram) Shutdown() { shutdownAll(h.Histogram) }
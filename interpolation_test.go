@@ -0,0 +1,82 @@
+package meteredwriter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestPercentiles(t *testing.T) {
+	values := []int64{50, 15, 40, 20, 35}
+	ps := []float64{0, 0.3, 0.4, 0.5, 0.75, 0.9, 1}
+	for _, tc := range []struct {
+		name   string
+		method Interpolation
+		want   []float64
+	}{
+		{"NearestRank", NearestRank, []float64{15, 20, 20, 35, 40, 50, 50}},
+		{"Linear", Linear, []float64{15, 23, 29, 35, 40, 46, 50}},
+		{"Midpoint", Midpoint, []float64{15, 27.5, 27.5, 35, 40, 45, 50}},
+	} {
+		got := Percentiles(values, ps, tc.method)
+		for i := range ps {
+			if math.Abs(got[i]-tc.want[i]) > 1e-9 {
+				t.Errorf("%s: percentile %v: want %v, got %v",
+					tc.name, ps[i], tc.want[i], got[i])
+			}
+		}
+	}
+	if values[0] != 50 {
+		t.Fatal("Percentiles should not modify provided values")
+	}
+}
+
+func TestInterpolatedHistogram(t *testing.T) {
+	h := metrics.NewHistogram(metrics.NewUniformSample(100))
+	ih := NewInterpolatedHistogram(h, h.Sample().Values, NearestRank)
+	if p := ih.Percentile(0.5); p != 0 {
+		t.Fatal("empty histogram percentile should be 0, got:", p)
+	}
+	for _, v := range []int64{1, 2, 3, 4} {
+		ih.Update(v)
+	}
+	if p := ih.Percentile(0.5); p != 2 {
+		t.Fatal("nearest rank median of 1..4 should be 2, got:", p)
+	}
+	if cnt := ih.Count(); cnt != 4 {
+		t.Fatal("should have 4 registered samples, got:", cnt)
+	}
+}
+
+func TestPercentiles_NearestRank(t *testing.T) {
+	values := make([]int64, 100)
+	for i := range values {
+		values[i] = int64(i + 1)
+	}
+	for _, tc := range []struct {
+		p    float64
+		want float64
+	}{
+		{0.07, 7},
+		{0.29, 29},
+		{0.57, 57},
+		{0.995, 100},
+		{1e-12, 1},
+		{math.NaN(), math.NaN()},
+	} {
+		got := Percentiles(values, []float64{tc.p}, NearestRank)[0]
+		if got != tc.want && !(math.IsNaN(got) && math.IsNaN(tc.want)) {
+			t.Errorf("percentile %v: want %v, got %v", tc.p, tc.want, got)
+		}
+	}
+	for _, method := range []Interpolation{Linear, Midpoint} {
+		if got := Percentiles(values, []float64{math.NaN()}, method)[0]; !math.IsNaN(got) {
+			t.Errorf("method %v: want NaN for NaN percentile, got %v", method, got)
+		}
+	}
+}
+
+func TestInterpolatedHistogram_Registrar(t *testing.T) {
+	testRegistrarForwarding(t, func(h Histogram) Histogram { return NewInterpolatedHistogram(h, func() []int64 { return nil }, Linear) })
+}
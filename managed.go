@@ -0,0 +1,57 @@
+package meteredwriter
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ManagedWriter is a MeteredWriter bound to SelfCleaningHistogram, which
+// releases its registration exactly once: on the first Close call, or, if
+// writer is dropped without Close, when it is garbage collected. See
+// SelfCleaningHistogram.NewWriter.
+type ManagedWriter struct {
+	MeteredWriter
+	once sync.Once
+	err  error
+}
+
+// NewWriter returns ManagedWriter attaching histogram to writer as
+// NewMeteredWriter does, registering it with histogram. Registration is
+// released exactly once: repeated Close calls do not call Done() again, and a
+// finalizer set with runtime.SetFinalizer calls Done() if ManagedWriter is
+// garbage collected without being closed; finalizer does not close
+// underlying writer.
+//
+// Finalizer is only a safety net: it runs at unspecified time after
+// ManagedWriter becomes unreachable, if at all, so self-cleaning of histogram is
+// delayed until then. It also does not track copies of embedded MeteredWriter
+// value, which must not outlive ManagedWriter. Always call Close when done.
+func (h *SelfCleaningHistogram) NewWriter(writer io.Writer, opts ...Option) *ManagedWriter {
+	w := &ManagedWriter{MeteredWriter: NewMeteredWriter(writer, h, opts...)}
+	runtime.SetFinalizer(w, (*ManagedWriter).release)
+	return w
+}
+
+// Close implements io.Closer interface. The first call closes embedded
+// MeteredWriter, releasing registration with histogram; subsequent calls
+// return the same error without doing anything.
+func (w *ManagedWriter) Close() error {
+	w.once.Do(func() {
+		runtime.SetFinalizer(w, nil)
+		w.err = w.MeteredWriter.Close()
+	})
+	return w.err
+}
+
+// release is called by finalizer.
+func (w *ManagedWriter) release() {
+	w.once.Do(func() {
+		if w.reg != nil {
+			w.reg.Done()
+		}
+		if w.o != nil && w.o.stop != nil {
+			w.o.stop()
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestManagedWriter(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer sh.Shutdown()
+	w1, w2 := sh.NewWriter(ioutil.Discard), sh.NewWriter(ioutil.Discard)
+	w1.Write([]byte("data"))
+	if n := sh.OutstandingRegistrations(); n != 2 {
+		t.Fatal("want 2 outstanding registrations, got:", n)
+	}
+	w1.Close()
+	w1.Close()
+	if n := sh.OutstandingRegistrations(); n != 1 {
+		t.Fatal("repeated Close should release registration once, outstanding:", n)
+	}
+	w2.Write([]byte("data"))
+	w2 = nil
+	t.Log("dropping writer without Close")
+	for deadline := time.Now().Add(5 * time.Second); sh.OutstandingRegistrations() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("finalizer did not release registration")
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cnt := sh.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+}
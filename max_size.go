@@ -0,0 +1,83 @@
+package meteredwriter
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrWriteTooLarge is returned by MaxSizeMeteredWriter for writes exceeding
+// configured maximum size.
+var ErrWriteTooLarge = errors.New("meteredwriter: write exceeds maximum size")
+
+// MaxSizeMeteredWriter is a MeteredWriter rejecting writes larger than
+// configured maximum size, which protects underlying writer from oversized
+// payloads.
+type MaxSizeMeteredWriter struct {
+	MeteredWriter
+	maxSize    int
+	rejections Counter
+}
+
+// NewMaxSizeMeteredWriter attaches provided histogram to writer as
+// NewMeteredWriter does; writes larger than maxSize bytes are rejected with
+// ErrWriteTooLarge without touching writer, each rejection increments
+// rejections counter, which may be nil.
+func NewMaxSizeMeteredWriter(writer io.Writer, h Histogram, maxSize int, rejections Counter, opts ...Option) MaxSizeMeteredWriter {
+	return MaxSizeMeteredWriter{
+		MeteredWriter: NewMeteredWriter(writer, h, opts...),
+		maxSize:       maxSize,
+		rejections:    rejections,
+	}
+}
+
+// Write implements io.Writer interface. Writes of up to maximum size bytes are
+// passed to MeteredWriter, larger ones are rejected with ErrWriteTooLarge.
+func (w MaxSizeMeteredWriter) Write(p []byte) (n int, err error) {
+	if !w.allowed(p) {
+		return 0, ErrWriteTooLarge
+	}
+	return w.MeteredWriter.Write(p)
+}
+
+// WriteContext writes p as MeteredWriter.WriteContext does, rejecting writes
+// larger than maximum size the same way Write does.
+func (w MaxSizeMeteredWriter) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	if !w.allowed(p) {
+		return 0, ErrWriteTooLarge
+	}
+	return w.MeteredWriter.WriteContext(ctx, p)
+}
+
+// allowed reports whether p fits into maximum size, counting rejection if it
+// does not.
+func (w MaxSizeMeteredWriter) allowed(p []byte) bool {
+	if len(p) <= w.maxSize {
+		return true
+	}
+	if w.rejections != nil {
+		w.rejections.Inc(1)
+	}
+	return false
+}
+
+// ReadFrom implements io.ReaderFrom interface, copying data with Write method
+// in chunks of at most maximum size, so that size limit cannot be bypassed by
+// io.Copy calling MeteredWriter's ReadFrom method, and copying data smaller
+// than maximum size never fails because of chunk size.
+func (w MaxSizeMeteredWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	size := w.maxSize
+	switch {
+	case size > 32<<10:
+		size = 32 << 10
+	case size < 1:
+		size = 1
+	}
+	return io.CopyBuffer(writerOnly{w}, readerOnly{r}, make([]byte, size))
+}
+
+// WriteString implements io.StringWriter interface, passing s to Write method,
+// so that size limit applies.
+func (w MaxSizeMeteredWriter) WriteString(s string) (n int, err error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,57 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMaxSizeMeteredWriter(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	rejections := new(testCounter)
+	buf := new(bytes.Buffer)
+	w := NewMaxSizeMeteredWriter(buf, histogram, 4, rejections)
+	if n, err := w.Write([]byte("abcd")); n != 4 || err != nil {
+		t.Fatalf("write of maximum size should succeed, got %d, %v", n, err)
+	}
+	if n, err := w.Write([]byte("abcde")); n != 0 || err != ErrWriteTooLarge {
+		t.Fatalf("write over maximum size should be rejected, got %d, %v", n, err)
+	}
+	if buf.String() != "abcd" {
+		t.Fatalf("rejected write should not reach underlying writer, got %q", buf)
+	}
+	if cnt := rejections.Count(); cnt != 1 {
+		t.Fatal("should have 1 rejection, got:", cnt)
+	}
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("should have 1 registered sample, got:", cnt)
+	}
+}
+
+func TestMaxSizeMeteredWriter_ReadFrom(t *testing.T) {
+	// ioutil.Discard implements io.ReaderFrom, which must not bypass limit
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	w := NewMaxSizeMeteredWriter(ioutil.Discard, histogram, 10, nil)
+	src := io.LimitReader(strings.NewReader(strings.Repeat("x", 1000)), 1000)
+	if _, err := io.Copy(w, src); err != nil {
+		t.Fatal("copy failed:", err)
+	}
+	if cnt := histogram.Count(); cnt != 100 {
+		t.Fatal("each chunk of maximum size should be sampled, got:", cnt)
+	}
+}
+
+func TestMaxSizeMeteredWriter_ReadFromSmallLimit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewMaxSizeMeteredWriter(buf, nil, 100, nil)
+	// strings.Reader implements io.WriterTo, which must not write past limit
+	src := strings.NewReader(strings.Repeat("x", 1000))
+	n, err := w.ReadFrom(src)
+	if err != nil || n != 1000 || buf.Len() != 1000 {
+		t.Fatalf("copy in chunks of maximum size failed: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,117 @@
+package meteredwriter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// trackedOverhead is an approximate size of SelfCleaningHistogram wrapper
+// itself, including its background goroutine stack.
+const trackedOverhead = 3 << 10
+
+// NewTrackedSelfCleaningHistogram returns SelfCleaningHistogram like
+// NewSelfCleaningHistogram does, additionally accounting its approximate
+// memory footprint in package-level total reported by EstimatedMemory.
+// reservoirSize should be set to the size of sample reservoir of wrapped
+// histogram, each sample is accounted as 8 bytes.
+//
+// If memory limit is set with SetMemoryLimit and creating new histogram
+// exceeds it, least recently updated tracked histograms are evicted by calling
+// their Shutdown method until total fits the limit again. Evicted histograms
+// keep their samples and can still be used, but no longer self-clean; owners
+// of histograms are expected to drop evicted ones, see Evicted method.
+func NewTrackedSelfCleaningHistogram(histogram Histogram, delay time.Duration, reservoirSize int) *SelfCleaningHistogram {
+	h := NewSelfCleaningHistogram(histogram, delay)
+	if reservoirSize < 0 {
+		reservoirSize = 0
+	}
+	h.mem = int64(reservoirSize)*8 + trackedOverhead
+	memory.track(h)
+	return h
+}
+
+// Evicted reports whether histogram was shut down, either explicitly or by
+// memory limit eviction, see NewTrackedSelfCleaningHistogram.
+func (h *SelfCleaningHistogram) Evicted() bool {
+	return atomic.LoadInt32(&h.closed) != 0
+}
+
+// EstimatedMemory returns approximate number of bytes used by histograms
+// created with NewTrackedSelfCleaningHistogram and not yet shut down.
+func EstimatedMemory() int64 {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	return memory.total
+}
+
+// SetMemoryLimit sets upper bound on EstimatedMemory, immediately evicting
+// least recently updated tracked histograms if it is exceeded. Limit less than
+// or equal to zero disables eviction, which is the default.
+func SetMemoryLimit(limit int64) {
+	memory.mu.Lock()
+	memory.limit = limit
+	victims := memory.evict()
+	memory.mu.Unlock()
+	shutdown(victims)
+}
+
+var memory = &memoryTracker{hs: make(map[*SelfCleaningHistogram]struct{})}
+
+// memoryTracker keeps track of histograms created with
+// NewTrackedSelfCleaningHistogram.
+type memoryTracker struct {
+	clock int64 // updated atomically; logical clock for LRU ordering
+
+	mu    sync.Mutex
+	total int64
+	limit int64
+	hs    map[*SelfCleaningHistogram]struct{}
+}
+
+func (m *memoryTracker) tick() int64 { return atomic.AddInt64(&m.clock, 1) }
+
+func (m *memoryTracker) track(h *SelfCleaningHistogram) {
+	atomic.StoreInt64(&h.lastUpdate, m.tick())
+	m.mu.Lock()
+	m.hs[h] = struct{}{}
+	m.total += h.mem
+	victims := m.evict()
+	m.mu.Unlock()
+	shutdown(victims)
+}
+
+func (m *memoryTracker) untrack(h *SelfCleaningHistogram) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.hs[h]; ok {
+		delete(m.hs, h)
+		m.total -= h.mem
+	}
+}
+
+// evict removes least recently updated histograms until total fits the limit,
+// returning removed histograms which should then be shut down. Must be called
+// with mu held.
+func (m *memoryTracker) evict() []*SelfCleaningHistogram {
+	var victims []*SelfCleaningHistogram
+	for m.limit > 0 && m.total > m.limit && len(m.hs) > 0 {
+		var lru *SelfCleaningHistogram
+		var oldest int64
+		for h := range m.hs {
+			if t := atomic.LoadInt64(&h.lastUpdate); lru == nil || t < oldest {
+				lru, oldest = h, t
+			}
+		}
+		delete(m.hs, lru)
+		m.total -= lru.mem
+		victims = append(victims, lru)
+	}
+	return victims
+}
+
+func shutdown(hs []*SelfCleaningHistogram) {
+	for _, h := range hs {
+		h.Shutdown()
+	}
+}
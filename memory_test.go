@@ -0,0 +1,86 @@
+package meteredwriter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestTrackedSelfCleaningHistogram(t *testing.T) {
+	defer SetMemoryLimit(0)
+	base := EstimatedMemory()
+	newHistogram := func() *SelfCleaningHistogram {
+		return NewTrackedSelfCleaningHistogram(
+			metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute, 100)
+	}
+	size := int64(100*8 + trackedOverhead)
+	h1, h2, h3 := newHistogram(), newHistogram(), newHistogram()
+	if m := EstimatedMemory() - base; m != 3*size {
+		t.Fatalf("want estimated memory %d, got %d", 3*size, m)
+	}
+	h1.Update(1)
+	h3.Update(1)
+	// h2 is the least recently updated now
+	SetMemoryLimit(base + 3*size)
+	h4 := newHistogram()
+	if !h2.Evicted() {
+		t.Fatal("least recently updated histogram should be evicted")
+	}
+	for _, h := range []*SelfCleaningHistogram{h1, h3, h4} {
+		if h.Evicted() {
+			t.Fatal("only one histogram should be evicted")
+		}
+	}
+	if m := EstimatedMemory() - base; m != 3*size {
+		t.Fatalf("want estimated memory %d, got %d", 3*size, m)
+	}
+	h2.Shutdown() // repeated Shutdown should not change accounting
+	h1.Shutdown()
+	if m := EstimatedMemory() - base; m != 2*size {
+		t.Fatalf("want estimated memory %d, got %d", 2*size, m)
+	}
+	SetMemoryLimit(base + size)
+	if !h3.Evicted() || h4.Evicted() {
+		t.Fatal("lowering limit should evict least recently updated histogram")
+	}
+	h4.Shutdown()
+	if m := EstimatedMemory(); m != base {
+		t.Fatal("all histograms shut down, unexpected estimated memory:", m)
+	}
+}
+
+func TestTrackedSelfCleaningHistogram_Concurrent(t *testing.T) {
+	defer SetMemoryLimit(0)
+	base := EstimatedMemory()
+	SetMemoryLimit(base + 10*(8+trackedOverhead))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var kept []*SelfCleaningHistogram
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				h := NewTrackedSelfCleaningHistogram(
+					metrics.NewHistogram(metrics.NewUniformSample(1)), time.Minute, 1)
+				h.Update(int64(j))
+				if j%2 == 0 {
+					h.Shutdown()
+					continue
+				}
+				mu.Lock()
+				kept = append(kept, h)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if m := EstimatedMemory() - base; m > 10*(8+trackedOverhead) {
+		t.Fatal("estimated memory exceeds limit:", m)
+	}
+	for _, h := range kept {
+		h.Shutdown() // don't leak tracked histograms into other tests
+	}
+}
@@ -13,8 +13,11 @@
 package meteredwriter
 
 import (
+	"errors"
 	"io"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,52 +36,377 @@ type Histogram interface {
 	Variance() float64
 }
 
+// Counter interface wraps a subset of methods of metrics.Counter interface so
+// it can be used without type conversion.
+type Counter interface {
+	Inc(int64)
+}
+
 // MeteredWriter wraps io.Writer and registers each write operation latency in
-// attached histogram
+// attached histogram or recorder
+//
+// MeteredWriter is safe for concurrent use if underlying writer, attached
+// histogram and counters are: its own state is immutable after creation,
+// except for counts which are updated atomically. Any shared mutable state
+// added to it must be guarded with atomics or a mutex.
+//
+// Latency is sampled as int64 nanoseconds, like time.Duration, so the largest
+// representable latency is about 292 years and even writes blocked for
+// minutes on a wedged disk are sampled exactly. Consumers converting samples
+// to narrower types, like int32 milliseconds, should clamp them themselves.
 type MeteredWriter struct {
 	io.Writer
-	h Histogram
+	r   Recorder
+	reg Registrar
+	o   *options
 }
 
 // NewMeteredWriter attaches provided histogram to writer, returning new
 // io.Writer. If histogram implements Registrar interface, this would also call
-// its Register() method.
-func NewMeteredWriter(writer io.Writer, h Histogram) MeteredWriter {
-	mw := MeteredWriter{
-		Writer: writer,
-		h:      h,
+// its Register() method. Nil histogram or NopHistogram disables latency
+// sampling. Optional features can be enabled with opts.
+func NewMeteredWriter(writer io.Writer, h Histogram, opts ...Option) MeteredWriter {
+	if _, ok := h.(NopHistogram); ok || h == nil {
+		return NewRecordingWriter(writer, nil, opts...)
+	}
+	mw := NewRecordingWriter(writer, HistogramRecorder(h), opts...)
+	if r, ok := h.(Registrar); ok {
+		mw.reg = r
+		r.Register()
+	}
+	return mw
+}
+
+// NewMeteredWriterNormalized is like NewMeteredWriter, but samples latency
+// per byte, i.e. write latency in nanoseconds divided by number of bytes
+// written, so that latency of small and large writes can be compared in the
+// same histogram.
+func NewMeteredWriterNormalized(writer io.Writer, h Histogram, opts ...Option) MeteredWriter {
+	if _, ok := h.(NopHistogram); ok || h == nil {
+		return NewRecordingWriter(writer, nil, opts...)
 	}
+	mw := NewRecordingWriter(writer, PerByteRecorder(h), opts...)
 	if r, ok := h.(Registrar); ok {
+		mw.reg = r
 		r.Register()
 	}
 	return mw
 }
 
+// NewMeteredWriterClock is like NewMeteredWriter, but uses now function
+// instead of time.Now to time writes, which allows deterministic tests of
+// sampled values. Nil now means time.Now. It is a shortcut for
+// NewMeteredWriter with WithClock option.
+func NewMeteredWriterClock(writer io.Writer, h Histogram, now func() time.Time) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithClock(now))
+}
+
+// NewMeteredWriterWithCounter is like NewMeteredWriter, but also increments c
+// by number of bytes written on each non-empty write. Nil c is ignored. It is
+// a shortcut for NewMeteredWriter with WithBytesWritten option.
+func NewMeteredWriterWithCounter(writer io.Writer, h Histogram, c Counter) MeteredWriter {
+	if c == nil {
+		return NewMeteredWriter(writer, h)
+	}
+	return NewMeteredWriter(writer, h, WithBytesWritten(c))
+}
+
+// NewMeteredWriterWithErrors is like NewMeteredWriter, but also increments
+// errs by one for each write returning an error. Nil errs is ignored. It is a
+// shortcut for NewMeteredWriter with WithErrorCount option.
+func NewMeteredWriterWithErrors(writer io.Writer, h Histogram, errs Counter) MeteredWriter {
+	if errs == nil {
+		return NewMeteredWriter(writer, h)
+	}
+	return NewMeteredWriter(writer, h, WithErrorCount(errs))
+}
+
+// NewMeteredWriterWithGauge is like NewMeteredWriter, but also updates g with
+// number of writes in progress. Nil g is ignored. It is a shortcut for
+// NewMeteredWriter with WithInFlightGauge option.
+func NewMeteredWriterWithGauge(writer io.Writer, h Histogram, g Gauge) MeteredWriter {
+	if g == nil {
+		return NewMeteredWriter(writer, h)
+	}
+	return NewMeteredWriter(writer, h, WithInFlightGauge(g))
+}
+
+// NewMeteredWriterSampled is like NewMeteredWriter, but samples latency of
+// only one of every n writes. It is a shortcut for NewMeteredWriter with
+// WithSampleEvery option, see its documentation for details.
+func NewMeteredWriterSampled(writer io.Writer, h Histogram, n int) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithSampleEvery(n))
+}
+
+// NewMeteredWriterUnit is like NewMeteredWriter, but records latency samples
+// in given unit instead of nanoseconds. It is a shortcut for NewMeteredWriter
+// with WithUnit option.
+func NewMeteredWriterUnit(writer io.Writer, h Histogram, unit time.Duration) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithUnit(unit))
+}
+
+// NewMeteredWriterMinBytes is like NewMeteredWriter, but only samples latency
+// of writes of at least min bytes. It is a shortcut for NewMeteredWriter with
+// WithMinBytes option, see its documentation for details.
+func NewMeteredWriterMinBytes(writer io.Writer, h Histogram, min int) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithMinBytes(min))
+}
+
+// NewMeteredWriterSLO is like NewMeteredWriter, but also increments slow
+// counter for each write taking longer than threshold. It is a shortcut for
+// NewMeteredWriter with WithSlowWrites option; other options may be given
+// with opts.
+func NewMeteredWriterSLO(writer io.Writer, h Histogram, threshold time.Duration, slow Counter, opts ...Option) MeteredWriter {
+	return NewMeteredWriter(writer, h, append([]Option{WithSlowWrites(threshold, slow)}, opts...)...)
+}
+
+// NewMeteredWriterIncludeEmpty is like NewMeteredWriter, but samples latency
+// of every write, including ones that wrote no bytes, while NewMeteredWriter
+// only samples non-empty writes. It is a shortcut for NewMeteredWriter with
+// WithEmptyWrites option.
+func NewMeteredWriterIncludeEmpty(writer io.Writer, h Histogram) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithEmptyWrites())
+}
+
+// NewMeteredWriterSized is like NewMeteredWriter, but also updates sizeH with
+// number of bytes written by each non-empty write. Either histogram may be
+// nil. It is a shortcut for NewMeteredWriter with WithSizeHistogram option.
+func NewMeteredWriterSized(writer io.Writer, latencyH, sizeH Histogram) MeteredWriter {
+	if sizeH == nil {
+		return NewMeteredWriter(writer, latencyH)
+	}
+	return NewMeteredWriter(writer, latencyH, WithSizeHistogram(sizeH))
+}
+
+// NewMeteredWriterTimeouts is like NewMeteredWriter, but samples latency of
+// writes failed with timeout error to timeoutH instead of h and counts them in
+// timeouts counter; either of them may be nil. It is a shortcut for
+// NewMeteredWriter with WithTimeouts option.
+func NewMeteredWriterTimeouts(writer io.Writer, h, timeoutH Histogram, timeouts Counter) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithTimeouts(timeoutH, timeouts))
+}
+
+// NewMeteredWriterCoalesced is like NewMeteredWriter, but its Write method
+// loops internally until p is fully written or an error occurs, sampling the
+// whole loop as a single write. It is a shortcut for NewMeteredWriter with
+// WithCoalescing option, see its documentation for details.
+func NewMeteredWriterCoalesced(writer io.Writer, h Histogram) MeteredWriter {
+	return NewMeteredWriter(writer, h, WithCoalescing())
+}
+
+// NewMeteredWriterTracked is like NewMeteredWriter, but also keeps duration of
+// the most recent sampled write, see MeteredWriter.LastLatency. It is a
+// shortcut for NewMeteredWriter with WithLastLatency option; other options may
+// be given with opts.
+func NewMeteredWriterTracked(writer io.Writer, h Histogram, opts ...Option) MeteredWriter {
+	return NewMeteredWriter(writer, h, append([]Option{WithLastLatency()}, opts...)...)
+}
+
+// NewRecordingWriter attaches provided recorder to writer, returning new
+// io.Writer. If recorder implements Registrar interface, this would also call
+// its Register() method. Optional features can be enabled with opts.
+func NewRecordingWriter(writer io.Writer, r Recorder, opts ...Option) MeteredWriter {
+	mw := MeteredWriter{
+		Writer: writer,
+		r:      r,
+	}
+	if len(opts) > 0 {
+		mw.o = new(options)
+		for _, opt := range opts {
+			opt(mw.o)
+		}
+		mw.o.init(r)
+	}
+	if reg, ok := r.(Registrar); ok {
+		mw.reg = reg
+		reg.Register()
+	}
+	return mw
+}
+
 // Write implements io.Writer interface; each write operation is timed and
-// sampled in attached histogram. Samples are stored in nanoseconds.
+// sampled in attached histogram or recorder. Samples are stored in
+// nanoseconds.
 func (mw MeteredWriter) Write(p []byte) (n int, err error) {
+	if mw.o != nil {
+		start, timed := mw.o.begin()
+		defer mw.o.leave()
+		n, err = mw.write(p)
+		mw.o.end(mw.r, start, timed, len(p), n, err, false)
+		return n, err
+	}
 	var start time.Time
-	if mw.h != nil {
+	if mw.r != nil {
 		start = time.Now()
 	}
 	n, err = mw.Writer.Write(p)
-	if n > 0 && mw.h != nil {
-		mw.h.Update(time.Now().Sub(start).Nanoseconds())
+	if n > 0 && mw.r != nil {
+		mw.r.Observe(time.Now().Sub(start).Nanoseconds(), n)
+	}
+	return n, err
+}
+
+// write writes p to underlying writer, retrying short writes if WithCoalescing
+// option is set.
+func (mw MeteredWriter) write(p []byte) (int, error) {
+	if mw.o != nil && mw.o.coalesce {
+		return writeFull(mw.Writer, p)
+	}
+	return mw.Writer.Write(p)
+}
+
+// WriteString implements io.StringWriter interface. If underlying writer
+// implements io.StringWriter, its WriteString method is used, avoiding
+// conversion to byte slice; otherwise s is passed to Write method. Either way
+// operation is timed and sampled as Write does.
+func (mw MeteredWriter) WriteString(s string) (n int, err error) {
+	sw, ok := mw.Writer.(io.StringWriter)
+	if !ok {
+		return mw.Write([]byte(s))
+	}
+	start, timed := mw.begin()
+	defer mw.leave()
+	if mw.o != nil && mw.o.coalesce {
+		n, err = writeStringFull(sw, s)
+	} else {
+		n, err = sw.WriteString(s)
 	}
+	mw.end(start, timed, len(s), n, err, false)
 	return n, err
 }
 
+// ReadFrom implements io.ReaderFrom interface. If underlying writer implements
+// io.ReaderFrom, its ReadFrom method is used, so that io.Copy keeps
+// optimizations like sendfile(2); whole operation is then timed and sampled as
+// a single write. Otherwise data is copied using Write method, so each chunk
+// is sampled separately. Either way, counters set with options account for
+// all bytes copied. Use ReadFromCounts to find out how often each of these
+// paths is taken.
+func (mw MeteredWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	rf, ok := mw.Writer.(io.ReaderFrom)
+	if !ok {
+		atomic.AddInt64(&readFromSlow, 1)
+		return io.Copy(writerOnly{mw}, r)
+	}
+	atomic.AddInt64(&readFromFast, 1)
+	start, timed := mw.begin()
+	defer mw.leave()
+	n, err = rf.ReadFrom(r)
+	mw.end(start, timed, int(n), int(n), err, false)
+	return n, err
+}
+
+// readFromFast and readFromSlow count MeteredWriter.ReadFrom calls delegated
+// to underlying io.ReaderFrom and falling back to copying with Write.
+var readFromFast, readFromSlow int64
+
+// ReadFromCounts returns number of MeteredWriter.ReadFrom calls made since
+// program start that were delegated to underlying writer's ReadFrom method
+// (fast) and that fell back to copying with Write method (slow). Fast path
+// produces one sample per call, while slow path produces one sample per
+// chunk, so these values help to interpret histograms.
+func ReadFromCounts() (fast, slow int64) {
+	return atomic.LoadInt64(&readFromFast), atomic.LoadInt64(&readFromSlow)
+}
+
+// begin returns start time of write operation and whether it should be timed.
+func (mw MeteredWriter) begin() (start time.Time, timed bool) {
+	if mw.o != nil {
+		return mw.o.begin()
+	}
+	if mw.r != nil {
+		return time.Now(), true
+	}
+	return start, false
+}
+
+// leave must be called once write operation started with begin returns,
+// whether or not it panics.
+func (mw MeteredWriter) leave() {
+	if mw.o != nil {
+		mw.o.leave()
+	}
+}
+
+// end finishes write operation started with begin, which was given bufLen
+// bytes and returned n and err. Latency of abandoned write is sampled even if
+// it wrote no bytes.
+func (mw MeteredWriter) end(start time.Time, timed bool, bufLen, n int, err error, abandoned bool) {
+	if mw.o != nil {
+		mw.o.end(mw.r, start, timed, bufLen, n, err, abandoned)
+		return
+	}
+	if timed && (n > 0 || abandoned) {
+		mw.r.Observe(time.Now().Sub(start).Nanoseconds(), n)
+	}
+}
+
+// readerOnly hides optional interfaces of wrapped reader, so that io.Copy
+// does not call its WriteTo method.
+type readerOnly struct {
+	io.Reader
+}
+
+// writerOnly hides optional interfaces of wrapped writer, so that io.Copy
+// does not call back into MeteredWriter.ReadFrom.
+type writerOnly struct {
+	io.Writer
+}
+
+// Unwrap returns underlying writer, so that wrapper chains can be traversed
+// back to the original writer, e.g. to call its Sync method.
+func (mw MeteredWriter) Unwrap() io.Writer { return mw.Writer }
+
+// WarmingUp reports whether MeteredWriter is still within warm-up period set
+// with WithWarmup option.
+func (mw MeteredWriter) WarmingUp() bool {
+	return mw.o != nil && mw.o.now().Before(mw.o.warmUntil)
+}
+
+// LastLatency returns duration of the most recent sampled write if
+// MeteredWriter was created with WithLastLatency option, or zero otherwise.
+// Durations are stored as int64 nanoseconds.
+func (mw MeteredWriter) LastLatency() time.Duration {
+	if mw.o == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&mw.o.last))
+}
+
+// Flush flushes underlying writer if it implements Flush() error method, like
+// *bufio.Writer does; otherwise it returns nil. Flush is not timed, so that
+// histogram only holds write latencies.
+func (mw MeteredWriter) Flush() error {
+	if f, ok := mw.Writer.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// flusher is implemented by buffered writers like *bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
 // Close implements io.Closer interface. If underlying writer implements
-// io.Closer, calling this method would also close it. If attached histogram
-// also implements Registrar interface, this would call its Done() method.
+// Flush() error method, it is flushed first. If underlying writer implements
+// io.Closer, calling this method would also close it, returning its error
+// unchanged, or flush error if close succeeded. If attached histogram also
+// implements Registrar interface, this would call its Done() method.
 func (mw MeteredWriter) Close() error {
-	if r, ok := mw.h.(Registrar); ok {
-		r.Done()
+	err := mw.Flush()
+	if mw.reg != nil {
+		mw.reg.Done()
+	}
+	if mw.o != nil && mw.o.stop != nil {
+		mw.o.stop()
 	}
 	if c, ok := mw.Writer.(io.Closer); ok {
-		return c.Close()
+		if cerr := c.Close(); cerr != nil {
+			return cerr
+		}
 	}
-	return nil
+	return err
 }
 
 // SelfCleaningHistogram wraps metrics.Histogram, adding self-cleaning feature
@@ -88,11 +416,32 @@ func (mw MeteredWriter) Close() error {
 // outstanding workers registered (for each Register() call Done() call were
 // made), self-cleaning timer would start, cleaning histogram's sample pool in
 // absence of Register() calls before timer fires.
+//
+// Snapshot is mutually exclusive with Update and Clear, so that snapshot
+// either reflects all samples held before clearing or none of them, and is
+// consistent with concurrent updates. Other methods of wrapped Histogram, like
+// Percentiles, are called directly and bypass this guard: use Snapshot to read
+// statistics which may be cleared concurrently.
 type SelfCleaningHistogram struct {
+	// updated atomically
+	lastClear     int64 // unix nanoseconds
+	lifetimeCount int64
+	lifetimeMax   int64
+	lastUpdate    int64 // memory tracker tick, see NewTrackedSelfCleaningHistogram
+	outstanding   int64 // number of Register calls not matched by Done
+	lastActivity  int64 // unix nanoseconds of the last Update in activity mode
+	closed        int32
+	mem           int64 // estimated size, non-zero if tracked
 	Histogram
-	c, q   chan struct{}
-	closed bool
-	wg     sync.WaitGroup
+	c, q     chan struct{}
+	exited   chan struct{} // closed once decay goroutine exits
+	activity bool          // see NewActivitySelfCleaningHistogram
+	wg       sync.WaitGroup
+	onClear  atomic.Value // clearHook
+	strategy atomic.Value // decayBox, see SetDecayStrategy
+	mu       sync.RWMutex // guards Update and Clear against Snapshot
+	lateOnce sync.Once    // logs Register call after Shutdown
+	decayMu  sync.Mutex   // serializes self-cleaning against shutdown
 }
 
 // Registrar interface can be used to track object's concurrent usage.
@@ -111,24 +460,72 @@ type Registrar interface {
 }
 
 // NewSelfCleaningHistogram returns SelfCleaningHistogram wrapping specified
-// histogram; its self-cleaning period set to delay.
+// histogram; its self-cleaning period set to delay. Non-positive delay makes
+// histogram clear as soon as it becomes idle, use NewSelfCleaningHistogramErr
+// to reject such values.
 func NewSelfCleaningHistogram(histogram Histogram, delay time.Duration) *SelfCleaningHistogram {
 	h := &SelfCleaningHistogram{
 		Histogram: histogram,
 		c:         make(chan struct{}),
 		q:         make(chan struct{}),
 	}
-	// make sure goroutine is started before returning
+	h.start(delay)
+	return h
+}
+
+// ErrInvalidDelay is returned by NewSelfCleaningHistogramErr for non-positive
+// self-cleaning period.
+var ErrInvalidDelay = errors.New("meteredwriter: self-cleaning delay must be positive")
+
+// NewSelfCleaningHistogramErr is like NewSelfCleaningHistogram, but returns
+// ErrInvalidDelay if delay is not positive, without starting background
+// goroutine.
+func NewSelfCleaningHistogramErr(histogram Histogram, delay time.Duration) (*SelfCleaningHistogram, error) {
+	if delay <= 0 {
+		return nil, ErrInvalidDelay
+	}
+	return NewSelfCleaningHistogram(histogram, delay), nil
+}
+
+// start starts decay goroutine, making sure it is running before returning.
+func (h *SelfCleaningHistogram) start(delay time.Duration) {
+	h.exited = make(chan struct{})
 	guard := make(chan struct{})
-	go h.decay(delay, guard)
+	if h.activity {
+		go h.decayActivity(delay, guard)
+	} else {
+		go h.decay(delay, guard)
+	}
 	<-guard
-	return h
+}
+
+// Reset restarts self-cleaning of histogram stopped with Shutdown, setting its
+// self-cleaning period to delay; samples are kept. It does nothing if
+// histogram was not shut down. Reset waits for the old background goroutine
+// to exit, and must only be called after Shutdown returned and while
+// histogram is not used: with no outstanding registrations and no concurrent
+// calls to any of its methods. Once Reset returns, histogram can be used as a
+// new one. Histograms created with NewTrackedSelfCleaningHistogram are
+// accounted in EstimatedMemory again.
+func (h *SelfCleaningHistogram) Reset(delay time.Duration) {
+	if atomic.LoadInt32(&h.closed) == 0 {
+		return
+	}
+	<-h.exited
+	h.c = make(chan struct{})
+	h.q = make(chan struct{})
+	h.start(delay)
+	atomic.StoreInt32(&h.closed, 0)
+	if h.mem != 0 {
+		memory.track(h)
+	}
 }
 
 // decay tracks usage of SelfCleaningHistogram, starting and stopping cleaning
 // timer as needed
 func (h *SelfCleaningHistogram) decay(delay time.Duration, guard chan<- struct{}) {
 	var t *time.Timer
+	defer close(h.exited)
 	close(guard)
 	for {
 		select {
@@ -143,15 +540,140 @@ func (h *SelfCleaningHistogram) decay(delay time.Duration, guard chan<- struct{}
 			t.Stop()
 		}
 		h.wg.Wait()
-		t = time.AfterFunc(delay, h.Clear)
+		t = time.AfterFunc(delay, h.selfClean)
+	}
+}
+
+// Update adds sample to histogram, also updating lifetime count and maximum
+// which are not reset on Clear.
+func (h *SelfCleaningHistogram) Update(v int64) {
+	h.mu.RLock()
+	h.Histogram.Update(v)
+	h.mu.RUnlock()
+	atomic.AddInt64(&h.lifetimeCount, 1)
+	for {
+		max := atomic.LoadInt64(&h.lifetimeMax)
+		if v <= max || atomic.CompareAndSwapInt64(&h.lifetimeMax, max, v) {
+			break
+		}
+	}
+	if h.mem != 0 {
+		atomic.StoreInt64(&h.lastUpdate, memory.tick())
+	}
+	if h.activity {
+		atomic.StoreInt64(&h.lastActivity, time.Now().UnixNano())
+	}
+}
+
+// LifetimeCount returns number of samples added to histogram since its
+// creation; unlike Count it is not reset when histogram is cleared.
+func (h *SelfCleaningHistogram) LifetimeCount() int64 {
+	return atomic.LoadInt64(&h.lifetimeCount)
+}
+
+// LifetimeMax returns maximum sample added to histogram since its creation;
+// unlike Max it is not reset when histogram is cleared.
+func (h *SelfCleaningHistogram) LifetimeMax() int64 {
+	return atomic.LoadInt64(&h.lifetimeMax)
+}
+
+// Clear clears histogram samples, recording the time of the operation, see
+// LastClear. Self-cleaning timer also uses this method.
+func (h *SelfCleaningHistogram) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Histogram.Clear()
+	atomic.StoreInt64(&h.lastClear, time.Now().UnixNano())
+}
+
+// Snapshot implements Snapshotter interface, returning histogram statistics
+// which are never torn by concurrent Update or Clear call, including one made
+// by self-cleaning timer.
+func (h *SelfCleaningHistogram) Snapshot() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return snapshot(h.Histogram)
+}
+
+// SnapshotAndClear returns histogram statistics and clears it in one guarded
+// operation, which makes it suitable for delta reporting: samples added
+// concurrently are reflected by either this or the next snapshot, and
+// self-cleaning timer cannot clear histogram in between.
+func (h *SelfCleaningHistogram) SnapshotAndClear() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := snapshot(h.Histogram)
+	h.Histogram.Clear()
+	atomic.StoreInt64(&h.lastClear, time.Now().UnixNano())
+	return s
+}
+
+// ClearNow clears histogram samples and restarts self-cleaning timer, so that
+// the next self-cleaning happens no earlier than one self-cleaning period
+// after this call. If there are outstanding registrations, timer is armed
+// once they are released, as usual. Unlike Clear, it should be used to flush
+// histogram on demand, e.g. at reporting boundaries.
+func (h *SelfCleaningHistogram) ClearNow() {
+	h.Clear()
+	select {
+	case h.c <- struct{}{}:
+	default:
+	}
+}
+
+// OnClear sets f to be called each time self-cleaning timer clears histogram,
+// right after samples are cleared (or after DecayStrategy set with
+// SetDecayStrategy is applied); explicit Clear calls do not trigger it. f
+// is called on its own goroutine without any locks held. Nil f removes
+// previously set callback.
+func (h *SelfCleaningHistogram) OnClear(f func()) {
+	h.onClear.Store(clearHook(f))
+}
+
+// clearHook is a type of callback set with OnClear.
+type clearHook func()
+
+// selfClean is called by self-cleaning timer. It checks whether histogram is
+// shut down and decays it under decayMu, so that shutdown can wait for decay
+// which is already running.
+func (h *SelfCleaningHistogram) selfClean() {
+	h.decayMu.Lock()
+	if atomic.LoadInt32(&h.closed) != 0 {
+		h.decayMu.Unlock()
+		return
+	}
+	h.decayStrategy().OnDecay(h)
+	h.decayMu.Unlock()
+	if f, _ := h.onClear.Load().(clearHook); f != nil {
+		f()
+	}
+}
+
+// LastClear returns time histogram was last cleared either by self-cleaning
+// timer or by explicit Clear call. It returns zero time if histogram was never
+// cleared.
+func (h *SelfCleaningHistogram) LastClear() time.Time {
+	if ns := atomic.LoadInt64(&h.lastClear); ns != 0 {
+		return time.Unix(0, ns)
 	}
+	return time.Time{}
 }
 
 // Register implements Registrar interface, using sync.WaitGroup.Add(1) for each
 // call, blocking self-cleaning timer until all object's users releases it with
-// Done() call.
+// Done() call. Register called after Shutdown is a no-op, so that late
+// callers do not leak registrations; the first such call is logged.
 func (h *SelfCleaningHistogram) Register() {
+	if atomic.LoadInt32(&h.closed) != 0 {
+		h.lateOnce.Do(func() {
+			log.Print("meteredwriter: SelfCleaningHistogram.Register called after Shutdown, ignored")
+		})
+		return
+	}
+	// WaitGroup counter is raised before registration becomes visible to
+	// Done, otherwise concurrent unmatched Done could drive it negative.
 	h.wg.Add(1)
+	atomic.AddInt64(&h.outstanding, 1)
 	select {
 	case h.c <- struct{}{}:
 	default:
@@ -159,17 +681,91 @@ func (h *SelfCleaningHistogram) Register() {
 }
 
 // Done implements Registrar interface, using sync.WaitGroup.Done() for each
-// call.
+// call. Done calls not matched by earlier Register calls are ignored instead
+// of panicking on negative WaitGroup counter.
 func (h *SelfCleaningHistogram) Done() {
+	for {
+		n := atomic.LoadInt64(&h.outstanding)
+		if n <= 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&h.outstanding, n, n-1) {
+			break
+		}
+	}
 	h.wg.Done()
 }
 
+// OutstandingRegistrations returns number of Register calls not yet matched
+// by Done calls, which helps to debug leaked registrations.
+func (h *SelfCleaningHistogram) OutstandingRegistrations() int {
+	return int(atomic.LoadInt64(&h.outstanding))
+}
+
+// IsIdle reports whether histogram has no outstanding registrations, so that
+// self-cleaning timer is armed or has already fired.
+func (h *SelfCleaningHistogram) IsIdle() bool {
+	return h.OutstandingRegistrations() == 0
+}
+
 // Shutdown implements Registrar interface, it stops background goroutine. This
 // method should be called as the very last method on object and needed only if
 // object has to be removed and garbage collected.
-func (h *SelfCleaningHistogram) Shutdown() {
-	if !h.closed {
-		h.closed = true
-		close(h.q)
+func (h *SelfCleaningHistogram) Shutdown() { h.shutdown() }
+
+// ShutdownWithSnapshot stops background goroutine like Shutdown does, then
+// calls f with final statistics of histogram, so that reporter can capture
+// them before histogram is dropped. Self-cleaning timer does not clear
+// histogram once shutdown started; if self-cleaning is already in progress,
+// ShutdownWithSnapshot waits for it to finish before taking snapshot, so
+// DecayStrategy must not call Shutdown itself. Like Shutdown, it is a no-op if histogram
+// is already shut down: f is called at most once.
+func (h *SelfCleaningHistogram) ShutdownWithSnapshot(f func(Stats)) {
+	if h.shutdown() {
+		f(Snapshot(h))
+	}
+}
+
+// shutdown stops background goroutine, reporting whether this call did it.
+// Once it returns, self-cleaning timer no longer touches histogram.
+func (h *SelfCleaningHistogram) shutdown() bool {
+	if !atomic.CompareAndSwapInt32(&h.closed, 0, 1) {
+		return false
+	}
+	h.decayMu.Lock() // wait for self-cleaning in progress
+	h.decayMu.Unlock()
+	close(h.q)
+	if h.mem != 0 {
+		memory.untrack(h)
+	}
+	return true
+}
+
+// register calls Register() method on each histogram implementing Registrar
+// interface.
+func register(hs ...Histogram) {
+	for _, h := range hs {
+		if r, ok := h.(Registrar); ok {
+			r.Register()
+		}
+	}
+}
+
+// done calls Done() method on each histogram implementing Registrar interface.
+func done(hs ...Histogram) {
+	for _, h := range hs {
+		if r, ok := h.(Registrar); ok {
+			r.Done()
+		}
+	}
+}
+
+// shutdownAll calls Shutdown() method on each histogram implementing Registrar
+// interface.
+func shutdownAll(hs ...Histogram) {
+	for _, h := range hs {
+		if r, ok := h.(Registrar); ok {
+			r.Shutdown()
+		}
 	}
 }
@@ -1,9 +1,17 @@
 package meteredwriter
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
+	"log"
+	"math"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -127,3 +135,1112 @@ func TestSelfCleaningHistogram_Shutdown(t *testing.T) {
 		t.Fatal("should have 3 registered samples, got:", cnt)
 	}
 }
+
+func TestMeteredWriter_DroppedBytes(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	dropped := new(testCounter)
+	mw := NewMeteredWriter(shortWriter{max: 3}, histogram, WithDroppedBytes(dropped))
+	for _, s := range []string{"ab", "abcd", "abcdefgh"} {
+		if _, err := mw.Write([]byte(s)); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if cnt := dropped.Count(); cnt != 6 {
+		t.Fatal("should have 6 dropped bytes, got:", cnt)
+	}
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+}
+
+func TestSelfCleaningHistogram_LastClear(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		50*time.Millisecond)
+	defer sh.Shutdown()
+	if lc := sh.LastClear(); !lc.IsZero() {
+		t.Fatal("histogram was never cleared, but LastClear returned:", lc)
+	}
+	before := time.Now()
+	sh.Register()
+	sh.Update(100)
+	sh.Done()
+	t.Log("waiting for histogram to clear")
+	time.Sleep(150 * time.Millisecond)
+	first := sh.LastClear()
+	if first.Before(before) {
+		t.Fatal("LastClear should advance after idle clear, got:", first)
+	}
+	sh.Clear()
+	if lc := sh.LastClear(); !lc.After(first) {
+		t.Fatal("LastClear should advance after explicit Clear, got:", lc)
+	}
+}
+
+func TestMeteredWriter_OutcomeHistograms(t *testing.T) {
+	success := metrics.NewHistogram(metrics.NewUniformSample(100))
+	failure := metrics.NewHistogram(metrics.NewUniformSample(100))
+	opt := WithOutcomeHistograms(success, failure)
+	ok := NewMeteredWriter(ioutil.Discard, nil, opt)
+	ok.Write([]byte("data"))
+	ok.Write(nil)
+	if success.Count() != 1 || failure.Count() != 0 {
+		t.Fatalf("expected 1 success and 0 failure samples, got %d and %d",
+			success.Count(), failure.Count())
+	}
+	errFailed := errors.New("write failed")
+	failing := NewMeteredWriter(errWriter{err: errFailed}, nil, opt)
+	if _, err := failing.Write([]byte("data")); err != errFailed {
+		t.Fatal("unexpected write error:", err)
+	}
+	partial := NewMeteredWriter(errWriter{n: 2, err: errFailed}, nil, opt)
+	partial.Write([]byte("data"))
+	if success.Count() != 1 || failure.Count() != 2 {
+		t.Fatalf("expected 1 success and 2 failure samples, got %d and %d",
+			success.Count(), failure.Count())
+	}
+}
+
+func TestSelfCleaningHistogram_Lifetime(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		50*time.Millisecond)
+	defer sh.Shutdown()
+	sh.Register()
+	sh.Update(150)
+	sh.Update(300)
+	sh.Update(50)
+	sh.Done()
+	t.Log("waiting for histogram to clear")
+	time.Sleep(150 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("should have 0 registered samples, got:", cnt)
+	}
+	if cnt := sh.LifetimeCount(); cnt != 3 {
+		t.Fatal("lifetime count should survive clear, got:", cnt)
+	}
+	if max := sh.LifetimeMax(); max != 300 {
+		t.Fatal("lifetime max should survive clear, got:", max)
+	}
+	sh.Update(100)
+	if sh.LifetimeCount() != 4 || sh.LifetimeMax() != 300 || sh.Max() != 100 {
+		t.Fatal("unexpected values after clear:",
+			sh.LifetimeCount(), sh.LifetimeMax(), sh.Max())
+	}
+}
+
+func TestMeteredWriter_Warmup(t *testing.T) {
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(&slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}},
+		histogram, WithClock(clock.Now), WithWarmup(time.Second))
+	if !mw.WarmingUp() {
+		t.Fatal("writer should be warming up right after creation")
+	}
+	for i := 0; i < 5; i++ {
+		mw.Write([]byte("data"))
+	}
+	if cnt := histogram.Count(); cnt != 0 {
+		t.Fatal("writes during warm-up should not be sampled, got:", cnt)
+	}
+	clock.Advance(time.Second)
+	if mw.WarmingUp() {
+		t.Fatal("writer should not be warming up after warm-up period")
+	}
+	mw.Write([]byte("data"))
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("should have 1 registered sample, got:", cnt)
+	}
+	if v := histogram.Max(); v != time.Millisecond.Nanoseconds() {
+		t.Fatal("unexpected sample value:", v)
+	}
+}
+
+func TestMeteredWriter_ReadFrom(t *testing.T) {
+	fast, slow := ReadFromCounts()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	data := strings.Repeat("x", 100<<10)
+	// wrap reader so that io.Copy does not use its WriteTo method
+	newReader := func() io.Reader {
+		return io.LimitReader(strings.NewReader(data), int64(len(data)))
+	}
+
+	// ioutil.Discard implements io.ReaderFrom
+	mw := NewMeteredWriter(ioutil.Discard, histogram)
+	if n, err := io.Copy(mw, newReader()); err != nil || n != int64(len(data)) {
+		t.Fatalf("failed to copy data: %d, %v", n, err)
+	}
+	if f, s := ReadFromCounts(); f != fast+1 || s != slow {
+		t.Fatalf("expected one fast path call, got fast: %d, slow: %d", f-fast, s-slow)
+	}
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("fast path should produce a single sample, got:", cnt)
+	}
+
+	written := new(testCounter)
+	mw = NewMeteredWriter(ioutil.Discard, nil, WithBytesWritten(written))
+	if _, err := io.Copy(mw, newReader()); err != nil {
+		t.Fatal(err)
+	}
+	if cnt := written.Count(); cnt != int64(len(data)) {
+		t.Fatal("fast path should count all bytes copied, got:", cnt)
+	}
+	fast++
+
+	histogram.Clear()
+	buf := new(bytes.Buffer)
+	mw = NewMeteredWriter(writerOnly{buf}, histogram)
+	if n, err := mw.ReadFrom(newReader()); err != nil || n != int64(len(data)) {
+		t.Fatalf("failed to copy data: %d, %v", n, err)
+	}
+	if f, s := ReadFromCounts(); f != fast+1 || s != slow+1 {
+		t.Fatalf("expected one slow path call, got fast: %d, slow: %d", f-fast, s-slow)
+	}
+	if buf.Len() != len(data) {
+		t.Fatal("unexpected number of bytes copied:", buf.Len())
+	}
+	if cnt := histogram.Count(); cnt < 2 {
+		t.Fatal("slow path should sample each chunk, got:", cnt)
+	}
+}
+
+type sampledKey struct{}
+
+func TestMeteredWriter_SampledContext(t *testing.T) {
+	sampled := func(ctx context.Context) bool {
+		v, _ := ctx.Value(sampledKey{}).(bool)
+		return v
+	}
+	for _, isSampled := range []bool{true, false} {
+		ctx := context.WithValue(context.Background(), sampledKey{}, isSampled)
+		histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+		writes := new(testCounter)
+		mw := NewMeteredWriter(ioutil.Discard, histogram,
+			WithSampledContext(ctx, sampled), WithWriteCount(writes))
+		mw.Write([]byte("data"))
+		mw.Write([]byte("data"))
+		want := int64(0)
+		if isSampled {
+			want = 2
+		}
+		if cnt := histogram.Count(); cnt != want {
+			t.Fatalf("sampled: %v, want %d samples, got %d", isSampled, want, cnt)
+		}
+		if cnt := writes.Count(); cnt != 2 {
+			t.Fatalf("sampled: %v, all writes should be counted, got %d", isSampled, cnt)
+		}
+	}
+}
+
+func TestMeteredWriter_CloseError(t *testing.T) {
+	errClose := &os.PathError{Op: "close", Path: "test", Err: os.ErrClosed}
+	w := &closeWriter{err: errClose}
+	r := &registrarRecorder{RecorderFunc: func(int64, int) {}}
+	mw := NewRecordingWriter(w, r)
+	err := mw.Close()
+	if err != error(errClose) {
+		t.Fatal("underlying writer close error should be returned unchanged, got:", err)
+	}
+	var pathErr *os.PathError
+	if !errors.Is(err, os.ErrClosed) || !errors.As(err, &pathErr) {
+		t.Fatal("close error should be inspectable with errors.Is/errors.As:", err)
+	}
+	if w.closed != 1 || r.done != 1 {
+		t.Fatal("close should both close writer and release recorder")
+	}
+}
+
+func TestMeteredWriter_Rounding(t *testing.T) {
+	for _, tc := range []struct {
+		granularity, delay, want time.Duration
+	}{
+		{0, 1234567 * time.Nanosecond, 1234567 * time.Nanosecond},
+		{-time.Second, 1234567 * time.Nanosecond, 1234567 * time.Nanosecond},
+		{100 * time.Microsecond, 1234567 * time.Nanosecond, 1200 * time.Microsecond},
+		{100 * time.Microsecond, 1250 * time.Microsecond, 1300 * time.Microsecond},
+		{time.Millisecond, 1500 * time.Microsecond, 2 * time.Millisecond},
+		{time.Millisecond, 400 * time.Microsecond, 0},
+	} {
+		clock := newFakeClock()
+		histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+		mw := NewMeteredWriter(&slowWriter{clock: clock, delays: []time.Duration{tc.delay}},
+			histogram, WithClock(clock.Now), WithRounding(tc.granularity))
+		mw.Write([]byte("data"))
+		if v := histogram.Max(); v != tc.want.Nanoseconds() {
+			t.Errorf("granularity %v, delay %v: want sample %v, got %v",
+				tc.granularity, tc.delay, tc.want, time.Duration(v))
+		}
+	}
+}
+
+func TestNewMeteredWriterClock(t *testing.T) {
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriterClock(&slowWriter{clock: clock,
+		delays: []time.Duration{1234 * time.Nanosecond, 5678 * time.Nanosecond}},
+		histogram, clock.Now)
+	mw.Write([]byte("data"))
+	mw.Write([]byte("data"))
+	if v := histogram.Min(); v != 1234 {
+		t.Fatal("unexpected first sample value:", v)
+	}
+	if v := histogram.Max(); v != 5678 {
+		t.Fatal("unexpected second sample value:", v)
+	}
+	NewMeteredWriterClock(ioutil.Discard, histogram, nil).Write([]byte("data"))
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("nil clock should fall back to time.Now, samples:", cnt)
+	}
+}
+
+func TestNewMeteredWriterWithCounter(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	written := new(testCounter)
+	mw := NewMeteredWriterWithCounter(shortWriter{max: 3}, histogram, written)
+	for _, s := range []string{"ab", "", "abcdefgh"} {
+		if _, err := mw.Write([]byte(s)); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if cnt := written.Count(); cnt != 5 {
+		t.Fatal("should have 5 bytes written, got:", cnt)
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+	NewMeteredWriterWithCounter(ioutil.Discard, histogram, nil).Write([]byte("data"))
+}
+
+func TestMeteredWriter_Unwrap(t *testing.T) {
+	buf := new(bytes.Buffer)
+	mw := NewMeteredWriter(NewMeteredWriter(buf, nil), nil)
+	inner, ok := mw.Unwrap().(interface{ Unwrap() io.Writer })
+	if !ok {
+		t.Fatal("wrapped MeteredWriter should be unwrappable")
+	}
+	if w := inner.Unwrap(); w != buf {
+		t.Fatalf("unexpected unwrapped writer: %T", w)
+	}
+}
+
+func TestNewMeteredWriterNormalized(t *testing.T) {
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriterNormalized(&slowWriter{clock: clock,
+		delays: []time.Duration{1000 * time.Nanosecond, 8000 * time.Nanosecond}},
+		histogram, WithClock(clock.Now))
+	mw.Write(make([]byte, 10))
+	mw.Write(make([]byte, 1000))
+	mw.Write(nil)
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+	if histogram.Max() != 100 || histogram.Min() != 8 {
+		t.Fatalf("unexpected per-byte samples: min %d, max %d", histogram.Min(), histogram.Max())
+	}
+}
+
+func TestNewMeteredWriterWithErrors(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	errs := new(testCounter)
+	errFailed := errors.New("write failed")
+	NewMeteredWriterWithErrors(ioutil.Discard, histogram, errs).Write([]byte("data"))
+	NewMeteredWriterWithErrors(errWriter{err: errFailed}, histogram, errs).Write([]byte("data"))
+	NewMeteredWriterWithErrors(errWriter{n: 2, err: errFailed}, histogram, errs).Write([]byte("data"))
+	if cnt := errs.Count(); cnt != 2 {
+		t.Fatal("should have 2 errors counted, got:", cnt)
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+}
+
+func TestSelfCleaningHistogram_OnClear(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		50*time.Millisecond)
+	defer sh.Shutdown()
+	cleared := make(chan int64, 1)
+	sh.OnClear(func() { cleared <- sh.Count() })
+	sh.Clear()
+	if len(cleared) != 0 {
+		t.Fatal("explicit Clear should not trigger callback")
+	}
+	sh.Register()
+	sh.Update(100)
+	sh.Done()
+	t.Log("waiting for histogram to clear")
+	select {
+	case cnt := <-cleared:
+		if cnt != 0 {
+			t.Fatal("callback should be called after samples are cleared, count:", cnt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback was not called")
+	}
+	sh.OnClear(nil)
+	sh.Register()
+	sh.Done()
+	time.Sleep(100 * time.Millisecond)
+	if len(cleared) != 0 {
+		t.Fatal("removed callback should not be called")
+	}
+}
+
+// stringWriter counts WriteString calls.
+type stringWriter struct {
+	bytes.Buffer
+	calls int
+}
+
+func (w *stringWriter) WriteString(s string) (int, error) {
+	w.calls++
+	return w.Buffer.WriteString(s)
+}
+
+func TestMeteredWriter_WriteString(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	sw := new(stringWriter)
+	mw := NewMeteredWriter(sw, histogram)
+	for _, s := range []string{"abc", "", "def"} {
+		if _, err := io.WriteString(mw, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sw.calls != 3 || sw.String() != "abcdef" {
+		t.Fatalf("underlying WriteString should be used, got %d calls, %q", sw.calls, sw.String())
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+	buf := new(bytes.Buffer)
+	mw = NewMeteredWriter(writerOnly{buf}, histogram)
+	if _, err := mw.WriteString("abc"); err != nil || buf.String() != "abc" {
+		t.Fatalf("fallback to Write failed: %q, %v", buf.String(), err)
+	}
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+}
+
+func TestNewMeteredWriterWithGauge(t *testing.T) {
+	const writers = 4
+	gauge := new(testGauge)
+	bw := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	mw := NewMeteredWriterWithGauge(bw, nil, gauge)
+	done := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		go func() { mw.Write([]byte("data")); done <- struct{}{} }()
+		<-bw.started
+	}
+	if v := gauge.Value(); v != writers {
+		t.Fatalf("want %d writes in flight, got %d", writers, v)
+	}
+	for i := 0; i < writers; i++ {
+		bw.release <- struct{}{}
+		<-done
+	}
+	if v := gauge.Value(); v != 0 {
+		t.Fatal("want no writes in flight, got:", v)
+	}
+	if v := gauge.Max(); v != writers {
+		t.Fatalf("want %d writes in flight at peak, got %d", writers, v)
+	}
+}
+
+func TestNewMeteredWriterIncludeEmpty(t *testing.T) {
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(&slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}},
+		histogram, WithEmptyWrites(), WithClock(clock.Now))
+	mw.Write(nil)
+	mw.Write([]byte("data"))
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("empty write should be sampled, got samples:", cnt)
+	}
+	if min := histogram.Min(); min != time.Millisecond.Nanoseconds() {
+		t.Fatal("unexpected latency of empty write:", time.Duration(min))
+	}
+	mw = NewMeteredWriterIncludeEmpty(shortWriter{max: 0}, histogram)
+	if n, _ := mw.Write([]byte("data")); n != 0 {
+		t.Fatal("writer should not accept any bytes, got:", n)
+	}
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("write of zero bytes should be sampled, got samples:", cnt)
+	}
+	NewMeteredWriterIncludeEmpty(ioutil.Discard, nil).Write(nil)
+}
+
+func TestNewMeteredWriterSized(t *testing.T) {
+	latency := metrics.NewHistogram(metrics.NewUniformSample(100))
+	sizes := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriterSized(ioutil.Discard, latency, sizes)
+	for _, size := range []int{10, 1000, 0, 100} {
+		mw.Write(make([]byte, size))
+	}
+	if max := sizes.Max(); max != 1000 {
+		t.Fatal("size histogram maximum should be the largest write, got:", max)
+	}
+	if sizes.Count() != 3 || latency.Count() != 3 {
+		t.Fatalf("want 3 samples in both histograms, got %d sizes and %d latencies",
+			sizes.Count(), latency.Count())
+	}
+	NewMeteredWriterSized(ioutil.Discard, nil, sizes).Write([]byte("data"))
+	NewMeteredWriterSized(ioutil.Discard, latency, nil).Write([]byte("data"))
+	if sizes.Count() != 4 || latency.Count() != 4 {
+		t.Fatalf("histograms should be nil-safe independently, got %d sizes and %d latencies",
+			sizes.Count(), latency.Count())
+	}
+}
+
+func TestMeteredWriter_WriteHooks(t *testing.T) {
+	clock := newFakeClock()
+	var starts int
+	var ends []time.Duration
+	var errs []error
+	errWrite := errors.New("write failed")
+	mw := NewMeteredWriter(&errWriter{n: 2, err: errWrite}, nil,
+		WithClock(clock.Now), WithUnit(time.Millisecond),
+		WithWriteHooks(func() { starts++; clock.Advance(time.Millisecond) },
+			func(n int, d time.Duration, err error) {
+				ends = append(ends, d)
+				errs = append(errs, err)
+			}))
+	if n, err := mw.Write([]byte("data")); n != 2 || err != errWrite {
+		t.Fatalf("write result should be passed unchanged, got %d, %v", n, err)
+	}
+	if starts != 1 || len(ends) != 1 || errs[0] != errWrite {
+		t.Fatalf("hooks should be called once, got %d starts, %d ends", starts, len(ends))
+	}
+	if ends[0] != 0 {
+		t.Fatal("start hook should run before write is timed, got duration:", ends[0])
+	}
+	NewMeteredWriter(ioutil.Discard, nil, WithWriteHooks(nil, nil)).Write([]byte("data"))
+
+	starts = 0
+	mw = NewMeteredWriter(ioutil.Discard, nil, WithWriteHooks(func() { starts++ }, nil))
+	mw.Write([]byte("data"))
+	if starts != 1 {
+		t.Fatal("start hook should be called without histogram, got:", starts)
+	}
+}
+
+func TestMeteredWriter_Flush(t *testing.T) {
+	buf := new(bytes.Buffer)
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(bufio.NewWriter(buf), histogram)
+	mw.Write([]byte("data"))
+	if buf.Len() != 0 {
+		t.Fatal("data should be buffered, got:", buf.String())
+	}
+	if err := mw.Flush(); err != nil || buf.String() != "data" {
+		t.Fatalf("data should reach destination on Flush: %q, %v", buf.String(), err)
+	}
+	mw.Write([]byte("more"))
+	if err := mw.Close(); err != nil || buf.String() != "datamore" {
+		t.Fatalf("data should reach destination on Close: %q, %v", buf.String(), err)
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("flush should not be sampled, got samples:", cnt)
+	}
+	if err := NewMeteredWriter(ioutil.Discard, nil).Flush(); err != nil {
+		t.Fatal("flush of unbuffered writer should be no-op, got:", err)
+	}
+}
+
+func TestMeteredWriter_Untimed(t *testing.T) {
+	var reads int
+	now := func() time.Time { reads++; return time.Now() }
+	count := new(testCounter)
+	mw := NewMeteredWriter(ioutil.Discard, nil, WithClock(now), WithWriteCount(count))
+	mw.Write([]byte("data"))
+	if reads != 0 || count.Count() != 1 {
+		t.Fatalf("writer without histogram should not read clock, got %d reads, %d writes",
+			reads, count.Count())
+	}
+	mw = NewMeteredWriter(ioutil.Discard, metrics.NewHistogram(metrics.NewUniformSample(100)), WithClock(now))
+	mw.Write(nil)
+	if reads != 1 {
+		t.Fatal("empty write should read clock only once, got:", reads)
+	}
+}
+
+func TestNewMeteredWriterWithGauge_Panic(t *testing.T) {
+	gauge := new(testGauge)
+	mw := NewMeteredWriterWithGauge(panicWriter{}, nil, gauge)
+	func() {
+		defer func() { recover() }()
+		mw.Write([]byte("data"))
+	}()
+	if v := gauge.Value(); v != 0 {
+		t.Fatal("want no writes in flight after panic, got:", v)
+	}
+}
+
+// TestMeteredWriter_Concurrent is mostly useful with -race flag.
+func TestMeteredWriter_Concurrent(t *testing.T) {
+	const writers, writes = 16, 500
+	histogram := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer histogram.Shutdown()
+	count, written := new(testCounter), new(testCounter)
+	plain := NewMeteredWriter(ioutil.Discard, histogram)
+	defer plain.Close()
+	withOpts := NewMeteredWriter(ioutil.Discard, histogram,
+		WithWriteCount(count), WithBytesWritten(written), WithInFlightGauge(new(testGauge)))
+	defer withOpts.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				plain.Write([]byte("data"))
+				withOpts.Write([]byte("data"))
+			}
+		}()
+	}
+	wg.Wait()
+	if cnt := histogram.LifetimeCount(); cnt != 2*writers*writes {
+		t.Fatalf("want %d samples, got %d", 2*writers*writes, cnt)
+	}
+	if count.Count() != writers*writes || written.Count() != 4*writers*writes {
+		t.Fatalf("unexpected counters: %d writes, %d bytes", count.Count(), written.Count())
+	}
+}
+
+func TestNewMeteredWriterSampled(t *testing.T) {
+	for _, tc := range []struct{ n, writes, want int }{
+		{0, 10, 10},
+		{1, 10, 10},
+		{3, 10, 4},
+		{10, 10, 1},
+	} {
+		histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+		mw := NewMeteredWriterSampled(ioutil.Discard, histogram, tc.n)
+		for i := 0; i < tc.writes; i++ {
+			mw.Write([]byte("data"))
+		}
+		if cnt := histogram.Count(); cnt != int64(tc.want) {
+			t.Errorf("1 of %d: want %d samples of %d writes, got %d", tc.n, tc.want, tc.writes, cnt)
+		}
+	}
+}
+
+func TestMeteredWriter_NopHistogram(t *testing.T) {
+	var h Histogram = NopHistogram{}
+	mw := NewMeteredWriter(ioutil.Discard, h)
+	for i := 0; i < 10; i++ {
+		mw.Write([]byte("data"))
+	}
+	io.Copy(mw, io.LimitReader(strings.NewReader("data"), 4))
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if h.Count() != 0 || h.Max() != 0 || len(h.Percentiles([]float64{0.5, 0.9})) != 2 {
+		t.Fatal("NopHistogram should record nothing")
+	}
+	if s := Snapshot(h); s != (Stats{}) {
+		t.Fatalf("unexpected NopHistogram stats: %+v", s)
+	}
+}
+
+func TestNewMeteredWriterNormalized_NopHistogram(t *testing.T) {
+	mw := NewMeteredWriterNormalized(ioutil.Discard, NopHistogram{})
+	if mw.r != nil {
+		t.Fatal("NopHistogram should not be attached to writer")
+	}
+	if _, err := mw.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelfCleaningHistogram_IsIdle(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer sh.Shutdown()
+	if !sh.IsIdle() {
+		t.Fatal("new histogram should be idle")
+	}
+	mw1 := NewMeteredWriter(ioutil.Discard, sh)
+	mw2 := NewMeteredWriter(ioutil.Discard, sh)
+	if sh.IsIdle() || sh.OutstandingRegistrations() != 2 {
+		t.Fatal("want 2 outstanding registrations, got:", sh.OutstandingRegistrations())
+	}
+	mw1.Close()
+	if sh.IsIdle() {
+		t.Fatal("histogram should not be idle while one writer is open")
+	}
+	mw2.Close()
+	if !sh.IsIdle() || sh.OutstandingRegistrations() != 0 {
+		t.Fatal("histogram should be idle once all writers are closed")
+	}
+}
+
+func TestSelfCleaningHistogram_ExtraDone(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer sh.Shutdown()
+	sh.Done()
+	sh.Register()
+	sh.Done()
+	sh.Done()
+	if n := sh.OutstandingRegistrations(); n != 0 {
+		t.Fatal("unmatched Done calls should be ignored, outstanding:", n)
+	}
+	sh.Register()
+	if n := sh.OutstandingRegistrations(); n != 1 {
+		t.Fatal("want 1 outstanding registration, got:", n)
+	}
+	sh.Done()
+}
+
+func TestSelfCleaningHistogram_Reset(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	sh.Reset(time.Second) // not shut down: does nothing
+	sh.Update(1)
+	sh.Shutdown()
+	t.Log("restarting histogram with shorter delay")
+	sh.Reset(50 * time.Millisecond)
+	defer sh.Shutdown()
+	if cnt := sh.Count(); cnt != 1 {
+		t.Fatal("Reset should keep samples, got:", cnt)
+	}
+	mw := NewMeteredWriter(ioutil.Discard, sh)
+	mw.Write([]byte("data"))
+	mw.Close()
+	if cnt := sh.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+	t.Log("waiting for histogram to clear")
+	time.Sleep(200 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("restarted histogram should self-clean, got:", cnt)
+	}
+}
+
+func TestSelfCleaningHistogram_ClearNow(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		200*time.Millisecond)
+	defer sh.Shutdown()
+	sh.Register()
+	sh.Update(1)
+	sh.Done()
+	time.Sleep(140 * time.Millisecond)
+	sh.ClearNow()
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("ClearNow should clear samples, got:", cnt)
+	}
+	sh.Update(1)
+	t.Log("waiting past original timer deadline")
+	time.Sleep(120 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 1 {
+		t.Fatal("ClearNow should restart self-cleaning timer, got:", cnt)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("histogram should self-clean after restarted timer fires, got:", cnt)
+	}
+}
+
+func TestNewMeteredWriterUnit(t *testing.T) {
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(&slowWriter{clock: clock, delays: []time.Duration{1500 * time.Microsecond}},
+		histogram, WithClock(clock.Now), WithUnit(time.Microsecond))
+	mw.Write([]byte("data"))
+	if v := histogram.Max(); v != 1500 {
+		t.Fatal("want sample in microseconds, got:", v)
+	}
+	if s := FormatUnit(histogram, time.Microsecond); !strings.Contains(s, "max=1.5ms") {
+		t.Fatal("unexpected summary:", s)
+	}
+	if s := FormatStatsUnit(histogram, time.Microsecond); !strings.Contains(s, "max=1.5ms") {
+		t.Fatal("unexpected summary:", s)
+	}
+	NewMeteredWriterUnit(ioutil.Discard, histogram, time.Microsecond).Write([]byte("data"))
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("should have 2 registered samples, got:", cnt)
+	}
+}
+
+func TestNewMeteredWriterMinBytes(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	buf := new(bytes.Buffer)
+	mw := NewMeteredWriterMinBytes(buf, histogram, 16)
+	for i := 0; i < 10; i++ {
+		size := 2
+		if i%2 == 1 {
+			size = 64
+		}
+		if n, err := mw.Write(make([]byte, size)); err != nil || n != size {
+			t.Fatalf("unexpected write result: %d, %v", n, err)
+		}
+	}
+	if buf.Len() != 5*2+5*64 {
+		t.Fatal("all writes should pass through, got bytes:", buf.Len())
+	}
+	if cnt := histogram.Count(); cnt != 5 {
+		t.Fatal("only large writes should be sampled, got:", cnt)
+	}
+}
+
+func TestMeteredWriter_Meters(t *testing.T) {
+	writes, written := new(testMeter), new(testMeter)
+	mw := NewMeteredWriter(shortWriter{max: 3}, nil, WithMeters(writes, written))
+	for _, s := range []string{"ab", "", "abcdefgh"} {
+		mw.Write([]byte(s))
+	}
+	if cnt := writes.Count(); cnt != 2 {
+		t.Fatal("writes meter should be marked for each non-empty write, got:", cnt)
+	}
+	if cnt := written.Count(); cnt != 5 {
+		t.Fatal("bytes meter should be marked with bytes written, got:", cnt)
+	}
+	NewMeteredWriter(ioutil.Discard, nil, WithMeters(nil, written)).Write([]byte("data"))
+	if cnt := written.Count(); cnt != 9 {
+		t.Fatal("unexpected bytes meter count:", cnt)
+	}
+}
+
+func TestNewMeteredWriterSLO(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	slow := new(testCounter)
+	clock := newFakeClock()
+	w := &slowWriter{clock: clock, delays: []time.Duration{
+		20 * time.Millisecond, 10 * time.Millisecond, 5 * time.Millisecond, 30 * time.Millisecond}}
+	mw := NewMeteredWriterSLO(w, histogram, 10*time.Millisecond, slow, WithClock(clock.Now))
+	for i := 0; i < 4; i++ {
+		mw.Write([]byte("data"))
+	}
+	if cnt := slow.Count(); cnt != 2 {
+		t.Fatal("want 2 slow writes, got:", cnt)
+	}
+	if cnt := histogram.Count(); cnt != 4 {
+		t.Fatal("should have 4 registered samples, got:", cnt)
+	}
+}
+
+func TestNewSelfCleaningHistogramErr(t *testing.T) {
+	for _, delay := range []time.Duration{0, -time.Second} {
+		if _, err := NewSelfCleaningHistogramErr(
+			metrics.NewHistogram(metrics.NewUniformSample(100)), delay); err != ErrInvalidDelay {
+			t.Fatalf("delay %v: want ErrInvalidDelay, got %v", delay, err)
+		}
+	}
+	sh, err := NewSelfCleaningHistogramErr(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.Shutdown()
+}
+
+func TestSelfCleaningHistogram_ShutdownWithSnapshot(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Millisecond)
+	mw := NewMeteredWriter(ioutil.Discard, sh)
+	for i := 0; i < 3; i++ {
+		mw.Write([]byte("data"))
+	}
+	var calls int
+	var stats Stats
+	report := func(s Stats) { calls++; stats = s }
+	sh.ShutdownWithSnapshot(report)
+	mw.Close() // releasing registration should not clear histogram after shutdown
+	time.Sleep(20 * time.Millisecond)
+	sh.ShutdownWithSnapshot(report)
+	sh.Shutdown()
+	if calls != 1 {
+		t.Fatal("callback should be called exactly once, got:", calls)
+	}
+	if stats.Count != 3 {
+		t.Fatal("want snapshot of 3 samples, got:", stats.Count)
+	}
+	if cnt := sh.Count(); cnt != 3 {
+		t.Fatal("histogram should not be cleared after shutdown, got:", cnt)
+	}
+}
+
+// blockingDecay is a DecayStrategy which signals entered, then waits for
+// release before clearing histogram.
+type blockingDecay struct{ entered, release chan struct{} }
+
+func (s blockingDecay) OnDecay(h Histogram) {
+	close(s.entered)
+	<-s.release
+	h.Clear()
+}
+
+func TestSelfCleaningHistogram_ShutdownDuringDecay(t *testing.T) {
+	s := blockingDecay{entered: make(chan struct{}), release: make(chan struct{})}
+	sh := NewSelfCleaningHistogramStrategy(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Hour, s)
+	sh.Update(100)
+	go sh.selfClean() // self-cleaning timer firing right before shutdown
+	<-s.entered
+	stats := make(chan Stats, 1)
+	go sh.ShutdownWithSnapshot(func(st Stats) { stats <- st })
+	select {
+	case <-stats:
+		t.Fatal("snapshot should not be taken while decay is in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(s.release)
+	st := <-stats
+	if cnt := sh.Count(); cnt != st.Count {
+		t.Fatalf("histogram changed after final snapshot: snapshot count %d, now %d", st.Count, cnt)
+	}
+	sh.Update(100)
+	sh.selfClean()
+	if cnt := sh.Count(); cnt != 1 {
+		t.Fatal("histogram should not be decayed after shutdown, got:", cnt)
+	}
+}
+
+func BenchmarkWriteSmall(b *testing.B) {
+	benchmarkWrite(b, NewMeteredWriter(ioutil.Discard,
+		metrics.NewHistogram(metrics.NewUniformSample(1028))), 16)
+}
+
+func BenchmarkWriteLarge(b *testing.B) {
+	benchmarkWrite(b, NewMeteredWriter(ioutil.Discard,
+		metrics.NewHistogram(metrics.NewUniformSample(1028))), 64<<10)
+}
+
+func BenchmarkWriteNilHist(b *testing.B) {
+	b.Run("plain", func(b *testing.B) {
+		benchmarkWrite(b, NewMeteredWriter(ioutil.Discard, nil), 16)
+	})
+	b.Run("counter", func(b *testing.B) {
+		benchmarkWrite(b, NewMeteredWriter(ioutil.Discard, nil, WithWriteCount(new(testCounter))), 16)
+	})
+}
+
+func benchmarkWrite(b *testing.B, mw MeteredWriter, size int) {
+	p := make([]byte, size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mw.Write(p)
+	}
+}
+
+// TestSelfCleaningHistogram_Snapshot is mostly useful with -race flag.
+func TestSelfCleaningHistogram_Snapshot(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Millisecond)
+	defer sh.Shutdown()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, f := range []func(){
+		func() { sh.Update(5) },
+		sh.ClearNow,
+	} {
+		wg.Add(1)
+		go func(f func()) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					f()
+				}
+			}
+		}(f)
+	}
+	for i := 0; i < 20000; i++ {
+		s := sh.Snapshot()
+		if s.Count > 0 && (s.Min != 5 || s.Max != 5 || s.P50 != 5) ||
+			s.Count == 0 && (s.Max != 0 || s.P50 != 0) {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("snapshot torn by concurrent clear: count %d, min %d, max %d, p50 %v",
+				s.Count, s.Min, s.Max, s.P50)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestSelfCleaningHistogram_RegisterAfterShutdown(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	sh.Shutdown()
+	sh.Register()
+	sh.Register()
+	if n := sh.OutstandingRegistrations(); n != 0 {
+		t.Fatal("Register after Shutdown should be a no-op, got registrations:", n)
+	}
+	sh.Done()
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Fatalf("late Register should be logged once, got %d lines: %q", n, buf.String())
+	}
+}
+
+func TestNewMeteredWriterTimeouts(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	timeoutH := metrics.NewHistogram(metrics.NewUniformSample(100))
+	timeouts := new(testCounter)
+	mw := NewMeteredWriterTimeouts(errWriter{n: 2, err: timeoutError{}}, histogram, timeoutH, timeouts)
+	mw.Write([]byte("data"))
+	if histogram.Count() != 0 || timeoutH.Count() != 1 || timeouts.Count() != 1 {
+		t.Fatalf("timeout should be routed to timeout sink, got %d regular, %d timeout samples, %d timeouts",
+			histogram.Count(), timeoutH.Count(), timeouts.Count())
+	}
+	mw = NewMeteredWriterTimeouts(errWriter{n: 2, err: errors.New("other error")}, histogram, timeoutH, timeouts)
+	mw.Write([]byte("data"))
+	if histogram.Count() != 1 || timeoutH.Count() != 1 || timeouts.Count() != 1 {
+		t.Fatal("other errors should be sampled as usual")
+	}
+	mw = NewMeteredWriterTimeouts(errWriter{n: 2, err: &os.PathError{Op: "write", Err: timeoutError{}}},
+		histogram, nil, timeouts)
+	mw.Write([]byte("data"))
+	if histogram.Count() != 1 || timeouts.Count() != 2 {
+		t.Fatal("wrapped timeout error should be detected")
+	}
+}
+
+// timeoutError is a net.Error reporting timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestSelfCleaningHistogram_SnapshotAndClear(t *testing.T) {
+	sh := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer sh.Shutdown()
+	mw := NewMeteredWriter(ioutil.Discard, sh)
+	defer mw.Close()
+	for i := 0; i < 3; i++ {
+		mw.Write([]byte("data"))
+	}
+	if s := sh.SnapshotAndClear(); s.Count != 3 {
+		t.Fatal("snapshot should have 3 samples, got:", s.Count)
+	}
+	if cnt := sh.Count(); cnt != 0 {
+		t.Fatal("histogram should be cleared, got samples:", cnt)
+	}
+	if sh.LastClear().IsZero() {
+		t.Fatal("clear time should be recorded")
+	}
+}
+
+func TestNewMeteredWriterCoalesced(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	buf := new(bytes.Buffer)
+	mw := NewMeteredWriterCoalesced(&chunkWriter{w: buf, max: 3}, histogram)
+	if n, err := mw.Write([]byte("abcdefgh")); n != 8 || err != nil {
+		t.Fatalf("write should be completed, got %d, %v", n, err)
+	}
+	if buf.String() != "abcdefgh" {
+		t.Fatal("unexpected data written:", buf.String())
+	}
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("retries should be sampled as one write, got samples:", cnt)
+	}
+	mw = NewMeteredWriterCoalesced(shortWriter{max: 0}, histogram)
+	if _, err := mw.Write([]byte("data")); err != io.ErrShortWrite {
+		t.Fatal("want io.ErrShortWrite, got:", err)
+	}
+}
+
+func TestNewMeteredWriterCoalesced_Methods(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	buf := new(bytes.Buffer)
+	cw := &chunkStringWriter{chunkWriter{w: buf, max: 3}}
+	mw := NewMeteredWriterCoalesced(cw, histogram)
+	if n, err := mw.WriteString("abcdefgh"); n != 8 || err != nil {
+		t.Fatalf("string write should be completed, got %d, %v", n, err)
+	}
+	if n, err := mw.WriteContext(context.Background(), []byte("ijklmnop")); n != 8 || err != nil {
+		t.Fatalf("context write should be completed, got %d, %v", n, err)
+	}
+	if buf.String() != "abcdefghijklmnop" {
+		t.Fatal("unexpected data written:", buf.String())
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("retries should be sampled as one write per call, got samples:", cnt)
+	}
+	cw.calls = 0
+	mw.Write(nil)
+	mw.WriteString("")
+	if cw.calls != 2 {
+		t.Fatal("empty writes should be passed to underlying writer, got calls:", cw.calls)
+	}
+}
+
+// chunkWriter writes at most max bytes of each buffer to w, counting calls.
+type chunkWriter struct {
+	w     io.Writer
+	max   int
+	calls int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.w.Write(p)
+}
+
+// chunkStringWriter is a chunkWriter also implementing io.StringWriter and
+// SetWriteDeadline method.
+type chunkStringWriter struct{ chunkWriter }
+
+func (w *chunkStringWriter) WriteString(s string) (int, error) { return w.Write([]byte(s)) }
+
+func (w *chunkStringWriter) SetWriteDeadline(time.Time) error { return nil }
+
+func TestMeteredWriter_LastLatency(t *testing.T) {
+	clock := newFakeClock()
+	sw := &slowWriter{clock: clock, delays: []time.Duration{time.Millisecond, 250 * time.Millisecond}}
+	mw := NewMeteredWriterTracked(sw, nil, WithClock(clock.Now))
+	if d := mw.LastLatency(); d != 0 {
+		t.Fatal("want zero latency before any write, got:", d)
+	}
+	mw.Write([]byte("data"))
+	if d := mw.LastLatency(); d != time.Millisecond {
+		t.Fatal("unexpected last latency:", d)
+	}
+	mw.Write([]byte("data"))
+	if d := mw.LastLatency(); d != 250*time.Millisecond {
+		t.Fatal("unexpected last latency:", d)
+	}
+	mw.Write(nil)
+	if d := mw.LastLatency(); d != 250*time.Millisecond {
+		t.Fatal("empty write should not change last latency, got:", d)
+	}
+	if d := NewMeteredWriter(sw, nil, WithClock(clock.Now)).LastLatency(); d != 0 {
+		t.Fatal("last latency should not be tracked by default, got:", d)
+	}
+}
+
+func TestMeteredWriter_VerySlowWrite(t *testing.T) {
+	const delay = 7 * time.Minute
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(&slowWriter{clock: clock, delays: []time.Duration{delay}},
+		histogram, WithClock(clock.Now))
+	mw.Write([]byte("data"))
+	if max := histogram.Max(); max != int64(delay) {
+		t.Fatalf("want %d nanoseconds sampled, got %d", int64(delay), max)
+	}
+	if s := FormatStats(histogram); !strings.HasSuffix(s, " max=420s") {
+		t.Fatal("unexpected formatting of slow write:", s)
+	}
+	histogram.Clear()
+	histogram.Update(math.MaxInt64)
+	if s := Snapshot(histogram).String(); !strings.HasSuffix(s, " max=9223372037s") {
+		t.Fatal("unexpected formatting of the largest latency:", s)
+	}
+}
@@ -0,0 +1,102 @@
+package meteredwriter
+
+// MultiHistogram fans out each sample to several histograms, so that one
+// write can feed histograms with different lifecycles, e.g. a never-clearing
+// lifetime histogram together with SelfCleaningHistogram and
+// VolumeCleaningHistogram. Read methods report values of the first histogram.
+//
+// MultiHistogram implements Registrar interface routing its calls to each
+// histogram implementing Registrar, so every child manages its own decay
+// independently.
+type MultiHistogram struct {
+	hs []Histogram
+}
+
+// NewMultiHistogram returns MultiHistogram sampling to all of hs. Nil
+// histograms are skipped.
+func NewMultiHistogram(hs ...Histogram) *MultiHistogram {
+	m := &MultiHistogram{hs: make([]Histogram, 0, len(hs))}
+	for _, h := range hs {
+		if h != nil {
+			m.hs = append(m.hs, h)
+		}
+	}
+	return m
+}
+
+// FanoutHistogram returns Histogram forwarding Update and Clear calls to all
+// of hs and reporting values of the first one, so that one MeteredWriter can
+// feed several backends. It is the same as NewMultiHistogram.
+func FanoutHistogram(hs ...Histogram) *MultiHistogram { return NewMultiHistogram(hs...) }
+
+// Histograms returns histograms samples are sent to.
+func (m *MultiHistogram) Histograms() []Histogram {
+	return append([]Histogram(nil), m.hs...)
+}
+
+// Update adds sample to each histogram.
+func (m *MultiHistogram) Update(v int64) {
+	for _, h := range m.hs {
+		h.Update(v)
+	}
+}
+
+// Clear clears each histogram.
+func (m *MultiHistogram) Clear() {
+	for _, h := range m.hs {
+		h.Clear()
+	}
+}
+
+// Register implements Registrar interface calling Register() on each
+// histogram implementing Registrar.
+func (m *MultiHistogram) Register() {
+	register(m.hs...)
+}
+
+// Done implements Registrar interface calling Done() on each histogram
+// implementing Registrar.
+func (m *MultiHistogram) Done() {
+	done(m.hs...)
+}
+
+// Shutdown implements Registrar interface calling Shutdown() on each histogram
+// implementing Registrar.
+func (m *MultiHistogram) Shutdown() {
+	for _, h := range m.hs {
+		if r, ok := h.(Registrar); ok {
+			r.Shutdown()
+		}
+	}
+}
+
+func (m *MultiHistogram) first() Histogram {
+	if len(m.hs) == 0 {
+		return NopHistogram{}
+	}
+	return m.hs[0]
+}
+
+// Count returns Count() of the first histogram.
+func (m *MultiHistogram) Count() int64 { return m.first().Count() }
+
+// Max returns Max() of the first histogram.
+func (m *MultiHistogram) Max() int64 { return m.first().Max() }
+
+// Mean returns Mean() of the first histogram.
+func (m *MultiHistogram) Mean() float64 { return m.first().Mean() }
+
+// Min returns Min() of the first histogram.
+func (m *MultiHistogram) Min() int64 { return m.first().Min() }
+
+// Percentile returns Percentile() of the first histogram.
+func (m *MultiHistogram) Percentile(p float64) float64 { return m.first().Percentile(p) }
+
+// Percentiles returns Percentiles() of the first histogram.
+func (m *MultiHistogram) Percentiles(ps []float64) []float64 { return m.first().Percentiles(ps) }
+
+// StdDev returns StdDev() of the first histogram.
+func (m *MultiHistogram) StdDev() float64 { return m.first().StdDev() }
+
+// Variance returns Variance() of the first histogram.
+func (m *MultiHistogram) Variance() float64 { return m.first().Variance() }
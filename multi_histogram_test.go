@@ -0,0 +1,78 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMultiHistogram_MixedPolicies(t *testing.T) {
+	lifetime := metrics.NewHistogram(metrics.NewUniformSample(100))
+	recent := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		100*time.Millisecond)
+	defer recent.Shutdown()
+	batch := NewVolumeCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), 4)
+	mh := NewMultiHistogram(lifetime, recent, batch)
+
+	mw := NewMeteredWriter(&slowWriter{}, mh)
+	for i := 0; i < 6; i++ {
+		if _, err := mw.Write([]byte("data")); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal("metered writer close error:", err)
+	}
+	if cnt := lifetime.Count(); cnt != 6 {
+		t.Fatal("lifetime histogram should have 6 samples, got:", cnt)
+	}
+	if cnt := recent.Count(); cnt != 6 {
+		t.Fatal("self-cleaning histogram should have 6 samples, got:", cnt)
+	}
+	if cnt := batch.Count(); cnt != 2 {
+		t.Fatal("volume-cleaning histogram should have 2 samples, got:", cnt)
+	}
+	if cnt := mh.Count(); cnt != 6 {
+		t.Fatal("multi histogram should report first histogram count, got:", cnt)
+	}
+	t.Log("waiting for released self-cleaning histogram to clear")
+	time.Sleep(200 * time.Millisecond)
+	if cnt := recent.Count(); cnt != 0 {
+		t.Fatal("self-cleaning histogram should be empty, but has samples:", cnt)
+	}
+	if lifetime.Count() != 6 || batch.Count() != 2 {
+		t.Fatal("other histograms should keep their samples, got:",
+			lifetime.Count(), batch.Count())
+	}
+}
+
+func TestMultiHistogram_Empty(t *testing.T) {
+	mh := NewMultiHistogram(nil)
+	mh.Update(10)
+	if mh.Count() != 0 || len(mh.Percentiles([]float64{0.5, 0.9})) != 2 {
+		t.Fatal("empty multi histogram should report zero values")
+	}
+}
+
+func TestFanoutHistogram(t *testing.T) {
+	h1 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	h2 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(ioutil.Discard, FanoutHistogram(h1, h2))
+	for i := 0; i < 3; i++ {
+		mw.Write([]byte("data"))
+	}
+	mw.Close()
+	v1, v2 := h1.Sample().Values(), h2.Sample().Values()
+	if len(v1) != 3 || !reflect.DeepEqual(v1, v2) {
+		t.Fatalf("both histograms should receive the same samples, got %v and %v", v1, v2)
+	}
+}
+
+func TestVolumeCleaningHistogram_Registrar(t *testing.T) {
+	testRegistrarForwarding(t, func(h Histogram) Histogram { return NewVolumeCleaningHistogram(h, 10) })
+}
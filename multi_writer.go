@@ -0,0 +1,96 @@
+package meteredwriter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MeteredMultiWriter duplicates writes to multiple writers like io.MultiWriter
+// does, sampling latency of each destination to its own histogram, so that
+// slow destination can be identified.
+type MeteredMultiWriter struct {
+	writers    []MeteredWriter
+	bestEffort bool
+}
+
+// NewMeteredMultiWriter returns MeteredMultiWriter writing to all writers in
+// order, sampling latency of writers[i] to histograms[i]. If there are fewer
+// histograms than writers, the rest of writers are not metered; extra
+// histograms are ignored. If histograms implement Registrar interface, this
+// would also call their Register() methods.
+func NewMeteredMultiWriter(writers []io.Writer, histograms []Histogram) *MeteredMultiWriter {
+	mws := make([]MeteredWriter, len(writers))
+	for i, w := range writers {
+		var h Histogram
+		if i < len(histograms) {
+			h = histograms[i]
+		}
+		mws[i] = NewMeteredWriter(w, h)
+	}
+	return &MeteredMultiWriter{writers: mws}
+}
+
+// NewMeteredMultiWriterBestEffort returns MeteredMultiWriter like
+// NewMeteredMultiWriter does, but its Write does not stop on the first failed
+// destination: it writes to all writers and returns errors of the failed ones
+// joined together, each prefixed with the index of its writer. Latency of
+// successful writes is sampled as usual.
+func NewMeteredMultiWriterBestEffort(writers []io.Writer, histograms []Histogram) *MeteredMultiWriter {
+	m := NewMeteredMultiWriter(writers, histograms)
+	m.bestEffort = true
+	return m
+}
+
+// Write implements io.Writer interface, writing p to each writer in order. If
+// any write fails or is short, Write stops and returns its error (or
+// io.ErrShortWrite) like io.MultiWriter does; latency of writes made before
+// the failure is sampled as usual. In best-effort mode Write returns the
+// smallest number of bytes written to any writer.
+func (m *MeteredMultiWriter) Write(p []byte) (n int, err error) {
+	if m.bestEffort {
+		return m.writeAll(p)
+	}
+	for _, w := range m.writers {
+		n, err = w.Write(p)
+		if err != nil {
+			return n, err
+		}
+		if n != len(p) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return len(p), nil
+}
+
+func (m *MeteredMultiWriter) writeAll(p []byte) (int, error) {
+	min := len(p)
+	var errs []error
+	for i, w := range m.writers {
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("writer %d: %w", i, err))
+		}
+		if n < min {
+			min = n
+		}
+	}
+	return min, errors.Join(errs...)
+}
+
+// Close implements io.Closer interface, closing each underlying MeteredWriter:
+// writers implementing io.Closer are closed, histograms implementing
+// Registrar interface get their Done() methods called. It returns the first
+// error encountered.
+func (m *MeteredMultiWriter) Close() error {
+	var err error
+	for _, w := range m.writers {
+		if e := w.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
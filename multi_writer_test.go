@@ -0,0 +1,80 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredMultiWriter(t *testing.T) {
+	h1 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	h2 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	b1, b2, b3 := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	w := NewMeteredMultiWriter([]io.Writer{b1, b2, b3}, []Histogram{h1, h2})
+	for i := 0; i < 3; i++ {
+		if n, err := w.Write([]byte("data")); err != nil || n != 4 {
+			t.Fatalf("unexpected write result: %d, %v", n, err)
+		}
+	}
+	for _, b := range []*bytes.Buffer{b1, b2, b3} {
+		if b.String() != "datadatadata" {
+			t.Fatalf("unexpected destination content: %q", b.String())
+		}
+	}
+	if h1.Count() != 3 || h2.Count() != 3 {
+		t.Fatalf("want 3 samples per destination, got %d and %d", h1.Count(), h2.Count())
+	}
+
+	errFailed := errors.New("write failed")
+	h1.Clear()
+	h2.Clear()
+	w = NewMeteredMultiWriter([]io.Writer{b1, errWriter{err: errFailed}, b3},
+		[]Histogram{h1, h2, metrics.NewHistogram(metrics.NewUniformSample(100))})
+	if _, err := w.Write([]byte("data")); err != errFailed {
+		t.Fatal("want write error, got:", err)
+	}
+	if h1.Count() != 1 || h2.Count() != 0 {
+		t.Fatalf("latency before failure should be sampled, got %d and %d", h1.Count(), h2.Count())
+	}
+	if b3.Len() != 12 {
+		t.Fatal("writers after the failed one should not be written to")
+	}
+	w = NewMeteredMultiWriter([]io.Writer{shortWriter{max: 2}}, nil)
+	if _, err := w.Write([]byte("data")); err != io.ErrShortWrite {
+		t.Fatal("want io.ErrShortWrite, got:", err)
+	}
+}
+
+func TestMeteredMultiWriter_BestEffort(t *testing.T) {
+	h1 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	h2 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	h3 := metrics.NewHistogram(metrics.NewUniformSample(100))
+	b1, b3 := new(bytes.Buffer), new(bytes.Buffer)
+	errFailed := errors.New("write failed")
+	w := NewMeteredMultiWriterBestEffort([]io.Writer{b1, errWriter{err: errFailed}, b3},
+		[]Histogram{h1, h2, h3})
+	n, err := w.Write([]byte("data"))
+	if !errors.Is(err, errFailed) {
+		t.Fatal("want wrapped write error, got:", err)
+	}
+	if err.Error() != "writer 1: write failed" {
+		t.Fatal("error should name failed destination, got:", err)
+	}
+	if n != 0 {
+		t.Fatal("want smallest written count, got:", n)
+	}
+	if b1.String() != "data" || b3.String() != "data" {
+		t.Fatalf("all writers should be written to, got %q and %q", b1.String(), b3.String())
+	}
+	if h1.Count() != 1 || h2.Count() != 0 || h3.Count() != 1 {
+		t.Fatalf("successful writes should be sampled, got %d, %d and %d",
+			h1.Count(), h2.Count(), h3.Count())
+	}
+	w = NewMeteredMultiWriterBestEffort([]io.Writer{b1, b3}, nil)
+	if n, err := w.Write([]byte("data")); err != nil || n != 4 {
+		t.Fatalf("unexpected write result: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,36 @@
+package meteredwriter
+
+// NopHistogram is a Histogram discarding all samples and reporting zero
+// values. It can be used to disable metering without nil checks in calling
+// code; MeteredWriter created with NopHistogram does not time writes at all.
+type NopHistogram struct{}
+
+// Clear does nothing.
+func (NopHistogram) Clear() {}
+
+// Count returns zero.
+func (NopHistogram) Count() int64 { return 0 }
+
+// Max returns zero.
+func (NopHistogram) Max() int64 { return 0 }
+
+// Mean returns zero.
+func (NopHistogram) Mean() float64 { return 0 }
+
+// Min returns zero.
+func (NopHistogram) Min() int64 { return 0 }
+
+// Percentile returns zero.
+func (NopHistogram) Percentile(float64) float64 { return 0 }
+
+// Percentiles returns slice of zeroes of the same length as ps.
+func (NopHistogram) Percentiles(ps []float64) []float64 { return make([]float64, len(ps)) }
+
+// StdDev returns zero.
+func (NopHistogram) StdDev() float64 { return 0 }
+
+// Update does nothing.
+func (NopHistogram) Update(int64) {}
+
+// Variance returns zero.
+func (NopHistogram) Variance() float64 { return 0 }
@@ -0,0 +1,439 @@
+package meteredwriter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Gauge interface wraps a subset of methods of metrics.Gauge interface so it
+// can be used without type conversion.
+type Gauge interface {
+	Update(int64)
+}
+
+// Option configures optional MeteredWriter features, see NewMeteredWriter.
+type Option func(*options)
+
+type options struct {
+	inFlight         int64 // updated atomically
+	seq              int64 // updated atomically
+	last             int64 // updated atomically, see WithLastLatency
+	every            int64
+	gauge            Gauge
+	now              func() time.Time
+	stop             func() // called on MeteredWriter.Close
+	warmup           time.Duration
+	warmUntil        time.Time
+	ctx              context.Context
+	sampled          func(context.Context) bool
+	writes           Counter
+	written          Counter
+	errors           Counter
+	writeRate        Meter
+	byteRate         Meter
+	dropped          Counter
+	success, failure Histogram
+	rounding         time.Duration
+	unit             time.Duration
+	minBytes         int
+	slowAfter        time.Duration
+	slow             Counter
+	includeEmpty     bool
+	sizes            Histogram
+	onStart          func()
+	onEnd            func(n int, d time.Duration, err error)
+	untimed          bool // nothing consumes write latency
+	unregister       bool // see WithUnregister
+	timeoutH         Histogram
+	timeouts         Counter
+	coalesce         bool
+	track            bool
+}
+
+// addStop adds f to functions called on MeteredWriter.Close.
+func (o *options) addStop(f func()) {
+	if prev := o.stop; prev != nil {
+		o.stop = func() { prev(); f() }
+		return
+	}
+	o.stop = f
+}
+
+// init finalizes options once all of them are applied; r is a recorder of
+// MeteredWriter.
+func (o *options) init(r Recorder) {
+	if o.now == nil {
+		o.now = time.Now
+	}
+	o.untimed = r == nil && o.slow == nil && o.success == nil && o.failure == nil &&
+		o.onStart == nil && o.onEnd == nil && o.timeoutH == nil && !o.track
+	if o.warmup > 0 {
+		o.warmUntil = o.now().Add(o.warmup)
+	}
+}
+
+// WithClock makes MeteredWriter use now function instead of time.Now to time
+// writes, which is mostly useful for tests. Nil now means time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.now = now }
+}
+
+// WithCoarseClock makes MeteredWriter time writes with a new CoarseClock of
+// given resolution instead of time.Now, trading latency precision for cheaper
+// clock reads; see CoarseClock for details on precision loss. Clock is stopped
+// on MeteredWriter.Close. To share one clock between multiple writers, use
+// WithClock with CoarseClock.Now method instead. Non-positive resolution
+// disables coarse clock, so that time.Now is used.
+func WithCoarseClock(resolution time.Duration) Option {
+	return func(o *options) {
+		if resolution <= 0 {
+			return
+		}
+		c := NewCoarseClock(resolution)
+		o.now = c.Now
+		o.addStop(c.Stop)
+	}
+}
+
+// WithWarmup makes MeteredWriter skip latency samples of writes started within
+// d after its creation, so that steady-state distribution is not skewed by
+// startup noise like cold caches. Writes during warm-up period are passed to
+// underlying writer as usual. See also MeteredWriter.WarmingUp.
+func WithWarmup(d time.Duration) Option {
+	return func(o *options) { o.warmup = d }
+}
+
+// WithSampledContext makes MeteredWriter sample latency only of writes for
+// which sampled predicate called with ctx returns true; other writes are not
+// timed. It can be used to align latency samples with trace sampling without
+// dependency on a tracing library, e.g. with OpenTelemetry:
+//
+//	WithSampledContext(ctx, func(ctx context.Context) bool {
+//		return trace.SpanFromContext(ctx).SpanContext().IsSampled()
+//	})
+//
+// Counters are updated for all writes.
+func WithSampledContext(ctx context.Context, sampled func(context.Context) bool) Option {
+	return func(o *options) { o.ctx, o.sampled = ctx, sampled }
+}
+
+// WithSampleEvery makes MeteredWriter sample latency of only one of every n
+// writes (the first, the n+1-th and so on), which reduces overhead of timing
+// under very high write rates: writes that are not sampled do not read clock
+// at all. Selection uses a counter shared by all copies of MeteredWriter
+// rather than a random source, so it is predictable. Note that histogram
+// Count then reflects number of sampled writes, not the total; use
+// WithWriteCount to count all writes. n less than 2 means every write is
+// sampled.
+func WithSampleEvery(n int) Option {
+	return func(o *options) { o.every = int64(n) }
+}
+
+// WithWriteCount makes MeteredWriter increment c by one for each Write call.
+// Use DeltaCounter to get number of writes since the previous scrape.
+func WithWriteCount(c Counter) Option {
+	return func(o *options) { o.writes = c }
+}
+
+// WithBytesWritten makes MeteredWriter increment c by number of bytes written
+// on each non-empty write, which can be used for throughput dashboards.
+func WithBytesWritten(c Counter) Option {
+	return func(o *options) { o.written = c }
+}
+
+// WithMeters makes MeteredWriter mark writes meter with one and bytes meter
+// with number of bytes written on each non-empty write, so that meters report
+// writes per second and bytes per second. Either meter may be nil.
+func WithMeters(writes, bytes Meter) Option {
+	return func(o *options) { o.writeRate, o.byteRate = writes, bytes }
+}
+
+// WithSlowWrites makes MeteredWriter increment slow counter by one for each
+// timed write taking longer than threshold, which can be used for SLO
+// tracking. Writes are compared using the same timestamps as used for latency
+// samples, so this adds no clock reads; writes skipped by sampling options are
+// not timed and so are never counted as slow.
+func WithSlowWrites(threshold time.Duration, slow Counter) Option {
+	return func(o *options) { o.slowAfter, o.slow = threshold, slow }
+}
+
+// WithErrorCount makes MeteredWriter increment c by one for each Write call
+// returning non-nil error, regardless of number of bytes written, so that
+// write error rate can be monitored.
+func WithErrorCount(c Counter) Option {
+	return func(o *options) { o.errors = c }
+}
+
+// WithInFlightGauge makes MeteredWriter update g with number of write
+// operations currently in progress, which signals backpressure on underlying
+// writer shared by multiple goroutines. All copies of MeteredWriter share the
+// same in-flight count.
+func WithInFlightGauge(g Gauge) Option {
+	return func(o *options) { o.gauge = g }
+}
+
+// WithDroppedBytes makes MeteredWriter increment c by number of bytes that
+// underlying writer did not accept on a short write (n < len(p)) reported
+// without an error. Such writes are not retried by MeteredWriter, so c
+// quantifies data dropped by callers that do not retry short writes
+// themselves.
+func WithDroppedBytes(c Counter) Option {
+	return func(o *options) { o.dropped = c }
+}
+
+// WithOutcomeHistograms makes MeteredWriter additionally sample latency of
+// successful writes to success histogram and latency of failed writes to
+// failure histogram. Successful writes follow the usual rule of only being
+// sampled if they are non-empty, while failed writes are sampled regardless of
+// number of bytes written, as latency of a write failed on a timeout is
+// meaningful even if nothing was written. Either histogram may be nil.
+func WithOutcomeHistograms(success, failure Histogram) Option {
+	return func(o *options) { o.success, o.failure = success, failure }
+}
+
+// WithRounding makes MeteredWriter round each latency sample to the nearest
+// multiple of granularity before recording it, which reduces number of
+// distinct values for bucketed backends that cannot handle raw nanosecond
+// values. Note that this changes shape of distribution at scales close to
+// granularity: samples shorter than half of granularity are recorded as zero,
+// and percentiles become multiples of granularity. Granularity less than or
+// equal to zero disables rounding.
+func WithRounding(granularity time.Duration) Option {
+	return func(o *options) { o.rounding = granularity }
+}
+
+// WithUnit makes MeteredWriter record latency samples in given unit instead
+// of nanoseconds, e.g. in microseconds with time.Microsecond, truncating
+// fractions; this keeps values of millisecond-scale writes in a smaller range.
+// Use FormatUnit and FormatStatsUnit to render such histograms. Unit less than
+// or equal to one nanosecond means nanoseconds.
+func WithUnit(unit time.Duration) Option {
+	return func(o *options) { o.unit = unit }
+}
+
+// WithMinBytes makes MeteredWriter sample latency only of writes of at least
+// min bytes, excluding tiny writes whose latency is dominated by syscall
+// overhead. Smaller writes are passed to underlying writer as usual, and
+// are accounted by counters, but histogram Count then reflects only number
+// of writes that passed the filter. Failure histogram set with
+// WithOutcomeHistograms is not filtered.
+func WithMinBytes(min int) Option {
+	return func(o *options) { o.minBytes = min }
+}
+
+// WithLastLatency makes MeteredWriter keep duration of the most recent sampled
+// write, available with MeteredWriter.LastLatency method. It is meant for
+// tests and quick diagnostics where a histogram is overkill.
+func WithLastLatency() Option {
+	return func(o *options) { o.track = true }
+}
+
+// WithEmptyWrites makes MeteredWriter sample latency of all writes, including
+// ones that wrote no bytes, e.g. flush-only or keepalive writes that still
+// take time. By default only writes of at least one byte are sampled. Empty
+// writes are still not accounted by bytes written counters and meters.
+func WithEmptyWrites() Option {
+	return func(o *options) { o.includeEmpty = true }
+}
+
+// WithSizeHistogram makes MeteredWriter update h with number of bytes written
+// by each non-empty write, giving distribution of payload sizes next to
+// latency distribution. Register and Done methods of h are not called.
+func WithSizeHistogram(h Histogram) Option {
+	return func(o *options) { o.sizes = h }
+}
+
+// WithWriteHooks makes MeteredWriter call start right before each timed write
+// is passed to underlying writer and end once it returns, with number of bytes
+// written, write duration and error, e.g. to open and finish tracing spans
+// without this package depending on a tracing library. Either hook may be
+// nil. Hooks are called for all writes, unless WithSampleEvery or
+// WithSampledContext options skip timing of some of them; d is actual
+// duration, not affected by WithUnit and WithRounding options. Hooks are
+// called synchronously and should be fast; write error is returned to caller
+// as usual.
+func WithWriteHooks(start func(), end func(n int, d time.Duration, err error)) Option {
+	return func(o *options) { o.onStart, o.onEnd = start, end }
+}
+
+// WithTimeouts makes MeteredWriter treat writes failed with timeout error
+// (net.Error reporting Timeout(), e.g. on expired write deadline of net.Conn)
+// as a separate failure class: their latency is sampled to h instead of the
+// main histogram and failure histogram set with WithOutcomeHistograms, and
+// each of them increments c, so that timeouts do not inflate percentiles of
+// regular writes. Either h or c may be nil.
+func WithTimeouts(h Histogram, c Counter) Option {
+	return func(o *options) { o.timeoutH, o.timeouts = h, c }
+}
+
+// isTimeout reports whether err is a net.Error reporting timeout.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// WithCoalescing changes MeteredWriter Write, WriteString and WriteContext
+// methods to call underlying writer in a loop until p is fully written or an
+// error occurs, sampling latency and bytes of the whole loop as one write.
+// This keeps short writes (n < len(p)) and their retries from skewing
+// distribution towards small fast writes. Short write which makes no progress
+// and reports no error fails with io.ErrShortWrite. Empty writes are passed to
+// underlying writer once, as usual. ReadFrom delegated to underlying writer's
+// ReadFrom method is already sampled as a single write; its fallback path
+// copies data with Write, so it is coalesced too.
+func WithCoalescing() Option {
+	return func(o *options) { o.coalesce = true }
+}
+
+// writeFull writes p to w, retrying short writes. Empty p is written once.
+func writeFull(w io.Writer, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return w.Write(p)
+	}
+	for n < len(p) {
+		var nn int
+		nn, err = w.Write(p[n:])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		if nn == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// writeStringFull is like writeFull, but uses WriteString method of w.
+func writeStringFull(w io.StringWriter, s string) (n int, err error) {
+	if len(s) == 0 {
+		return w.WriteString(s)
+	}
+	for n < len(s) {
+		var nn int
+		nn, err = w.WriteString(s[n:])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		if nn == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// begin returns start time of write operation and whether its latency should
+// be sampled.
+func (o *options) begin() (start time.Time, timed bool) {
+	if o.gauge != nil {
+		o.gauge.Update(atomic.AddInt64(&o.inFlight, 1))
+	}
+	if o.untimed {
+		return start, false
+	}
+	if o.every > 1 && (atomic.AddInt64(&o.seq, 1)-1)%o.every != 0 {
+		return start, false
+	}
+	if o.sampled != nil && !o.sampled(o.ctx) {
+		return start, false
+	}
+	if o.onStart != nil {
+		o.onStart()
+	}
+	return o.now(), true
+}
+
+// leave decrements in-flight gauge raised by begin. It is called separately
+// from end, so that it can be deferred and keep gauge accurate even if
+// underlying writer panics.
+func (o *options) leave() {
+	if o.gauge != nil {
+		o.gauge.Update(atomic.AddInt64(&o.inFlight, -1))
+	}
+}
+
+// end updates counters after write of p of size bufLen returned n and err;
+// if write was timed, it also samples latency of write started at start.
+// Abandoned write, which failed without writing any bytes, is sampled as if it
+// was non-empty.
+func (o *options) end(r Recorder, start time.Time, timed bool, bufLen, n int, err error, abandoned bool) {
+	if o.writes != nil {
+		o.writes.Inc(1)
+	}
+	if o.errors != nil && err != nil {
+		o.errors.Inc(1)
+	}
+	if o.written != nil && n > 0 {
+		o.written.Inc(int64(n))
+	}
+	if o.writeRate != nil && n > 0 {
+		o.writeRate.Mark(1)
+	}
+	if o.byteRate != nil && n > 0 {
+		o.byteRate.Mark(int64(n))
+	}
+	if o.sizes != nil && n > 0 {
+		o.sizes.Update(int64(n))
+	}
+	if o.dropped != nil && err == nil && n < bufLen {
+		o.dropped.Inc(int64(bufLen - n))
+	}
+	timeout := err != nil && (o.timeouts != nil || o.timeoutH != nil) && isTimeout(err)
+	if timeout && o.timeouts != nil {
+		o.timeouts.Inc(1)
+	}
+	if !timed {
+		return
+	}
+	warm := start.Before(o.warmUntil)
+	sampled := !timeout && (n > 0 || o.includeEmpty || abandoned) && n >= o.minBytes
+	needed := sampled || err != nil && o.failure != nil || o.slow != nil ||
+		timeout && o.timeoutH != nil
+	if o.onEnd == nil && (warm || !needed) {
+		return // nothing to sample, save a clock read
+	}
+	d := o.now().Sub(start)
+	if o.onEnd != nil {
+		o.onEnd(n, d, err)
+	}
+	if warm {
+		return
+	}
+	if o.slow != nil && d > o.slowAfter {
+		o.slow.Inc(1)
+	}
+	if sampled && o.track {
+		atomic.StoreInt64(&o.last, int64(d))
+	}
+	elapsed := o.value(d)
+	if sampled && r != nil {
+		observe(r, d, elapsed, n)
+	}
+	switch {
+	case timeout:
+		if o.timeoutH != nil {
+			o.timeoutH.Update(elapsed)
+		}
+	case err != nil && o.failure != nil:
+		o.failure.Update(elapsed)
+	case err == nil && sampled && o.success != nil:
+		o.success.Update(elapsed)
+	}
+}
+
+// value converts write duration to sample value: nanoseconds or unit set with
+// WithUnit option, rounded if WithRounding option is set.
+func (o *options) value(d time.Duration) int64 {
+	if o.rounding > 0 {
+		d = d.Round(o.rounding)
+	}
+	if o.unit > time.Nanosecond {
+		return int64(d / o.unit)
+	}
+	return d.Nanoseconds()
+}
@@ -0,0 +1,66 @@
+// Package otelwriter provides io.Writer wrapper adding OpenTelemetry span
+// events for slow write operations.
+//
+// It is kept separate from meteredwriter package so that meteredwriter does
+// not depend on OpenTelemetry.
+package otelwriter
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventName is the name of span event added for slow writes.
+const EventName = "slow write"
+
+// Writer wraps io.Writer and adds an event to the span found in context for
+// each write taking at least configured threshold. Event carries write
+// duration in nanoseconds and number of bytes written as "duration_ns" and
+// "bytes" attributes.
+type Writer struct {
+	io.Writer
+	ctx       context.Context
+	threshold time.Duration
+	now       func() time.Time
+}
+
+// NewWriter returns Writer wrapping writer, adding events for writes taking at
+// least threshold to the span from ctx. Events are only added if span is
+// recording.
+func NewWriter(ctx context.Context, writer io.Writer, threshold time.Duration) *Writer {
+	return &Writer{
+		Writer:    writer,
+		ctx:       ctx,
+		threshold: threshold,
+		now:       time.Now,
+	}
+}
+
+// Write implements io.Writer interface; each write operation is timed and if
+// it is slower than threshold, event is added to the span.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	start := w.now()
+	n, err = w.Writer.Write(p)
+	if d := w.now().Sub(start); d >= w.threshold {
+		if span := trace.SpanFromContext(w.ctx); span.IsRecording() {
+			span.AddEvent(EventName, trace.WithAttributes(
+				attribute.Int64("duration_ns", d.Nanoseconds()),
+				attribute.Int("bytes", n),
+			))
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it.
+func (w *Writer) Close() error {
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
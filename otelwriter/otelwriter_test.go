@@ -0,0 +1,70 @@
+package otelwriter
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeSpan is a recording span collecting events; methods not overridden are
+// served by embedded non-recording span.
+type fakeSpan struct {
+	trace.Span
+	events [][]attribute.KeyValue
+}
+
+func (s *fakeSpan) IsRecording() bool { return true }
+
+func (s *fakeSpan) AddEvent(name string, opts ...trace.EventOption) {
+	if name == EventName {
+		s.events = append(s.events, trace.NewEventConfig(opts...).Attributes())
+	}
+}
+
+func TestWriter(t *testing.T) {
+	span := &fakeSpan{Span: trace.SpanFromContext(context.Background())}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+	w := NewWriter(ctx, ioutil.Discard, 10*time.Millisecond)
+	delays := []time.Duration{time.Millisecond, 20 * time.Millisecond, 5 * time.Millisecond}
+	var now time.Time
+	var calls int
+	w.now = func() time.Time {
+		// every other call ends a write
+		if calls%2 == 1 {
+			now = now.Add(delays[calls/2])
+		}
+		calls++
+		return now
+	}
+	for range delays {
+		if _, err := w.Write([]byte("data")); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if len(span.events) != 1 {
+		t.Fatal("expected exactly one slow write event, got:", len(span.events))
+	}
+	for _, kv := range span.events[0] {
+		switch kv.Key {
+		case "duration_ns":
+			if v := kv.Value.AsInt64(); v != (20 * time.Millisecond).Nanoseconds() {
+				t.Fatal("unexpected duration attribute:", v)
+			}
+		case "bytes":
+			if v := kv.Value.AsInt64(); v != 4 {
+				t.Fatal("unexpected bytes attribute:", v)
+			}
+		}
+	}
+}
+
+func TestWriter_NoSpan(t *testing.T) {
+	w := NewWriter(context.Background(), ioutil.Discard, 0)
+	if n, err := w.Write([]byte("data")); n != 4 || err != nil {
+		t.Fatalf("write without span should succeed, got %d, %v", n, err)
+	}
+}
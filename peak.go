@@ -0,0 +1,90 @@
+package meteredwriter
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// PeakHistogram is a Histogram keeping only count, minimum, maximum and sum
+// of samples in atomic counters, without a reservoir, which makes Update much
+// cheaper for hot paths where only peak latency matters. Percentile and
+// Percentiles report maximum for any percentile, StdDev and Variance report
+// zero. Clear resets counters one by one, so values read concurrently with
+// Clear may be inconsistent.
+type PeakHistogram struct {
+	count, sum, min, max int64 // updated atomically
+}
+
+// NewPeakHistogram returns new PeakHistogram.
+func NewPeakHistogram() *PeakHistogram {
+	return &PeakHistogram{min: math.MaxInt64}
+}
+
+// Update adds sample to histogram.
+func (h *PeakHistogram) Update(v int64) {
+	for {
+		min := atomic.LoadInt64(&h.min)
+		if v >= min || atomic.CompareAndSwapInt64(&h.min, min, v) {
+			break
+		}
+	}
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if v <= max || atomic.CompareAndSwapInt64(&h.max, max, v) {
+			break
+		}
+	}
+	atomic.AddInt64(&h.sum, v)
+	atomic.AddInt64(&h.count, 1)
+}
+
+// Clear resets histogram.
+func (h *PeakHistogram) Clear() {
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.min, math.MaxInt64)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// Count returns number of samples added since creation or last Clear.
+func (h *PeakHistogram) Count() int64 { return atomic.LoadInt64(&h.count) }
+
+// Max returns maximum sample, or zero if there are no samples.
+func (h *PeakHistogram) Max() int64 { return atomic.LoadInt64(&h.max) }
+
+// Min returns minimum sample, or zero if there are no samples.
+func (h *PeakHistogram) Min() int64 {
+	if min := atomic.LoadInt64(&h.min); min != math.MaxInt64 {
+		return min
+	}
+	return 0
+}
+
+// Mean returns running mean of samples, or zero if there are no samples.
+func (h *PeakHistogram) Mean() float64 {
+	count := atomic.LoadInt64(&h.count)
+	if count == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&h.sum)) / float64(count)
+}
+
+// Percentile returns maximum sample for any p.
+func (h *PeakHistogram) Percentile(float64) float64 { return float64(h.Max()) }
+
+// Percentiles returns slice of the same length as ps filled with maximum
+// sample.
+func (h *PeakHistogram) Percentiles(ps []float64) []float64 {
+	out := make([]float64, len(ps))
+	max := float64(h.Max())
+	for i := range out {
+		out[i] = max
+	}
+	return out
+}
+
+// StdDev returns zero, as PeakHistogram does not track it.
+func (h *PeakHistogram) StdDev() float64 { return 0 }
+
+// Variance returns zero, as PeakHistogram does not track it.
+func (h *PeakHistogram) Variance() float64 { return 0 }
@@ -0,0 +1,44 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestPeakHistogram(t *testing.T) {
+	const writers, updates = 8, 1000
+	h := NewPeakHistogram()
+	if h.Min() != 0 || h.Max() != 0 || h.Mean() != 0 {
+		t.Fatal("empty histogram should report zero values")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 1; j <= updates; j++ {
+				h.Update(int64(j))
+			}
+		}()
+	}
+	wg.Wait()
+	if h.Count() != writers*updates || h.Min() != 1 || h.Max() != updates {
+		t.Fatalf("unexpected stats: count %d, min %d, max %d", h.Count(), h.Min(), h.Max())
+	}
+	if mean := h.Mean(); mean != (updates+1)/2.0 {
+		t.Fatal("unexpected mean:", mean)
+	}
+	if ps := h.Percentiles([]float64{0.5, 0.99}); ps[0] != updates || ps[1] != updates {
+		t.Fatal("percentiles should report maximum, got:", ps)
+	}
+	h.Clear()
+	if h.Count() != 0 || h.Min() != 0 || h.Max() != 0 {
+		t.Fatal("histogram should be reset by Clear")
+	}
+	mw := NewMeteredWriter(ioutil.Discard, h)
+	mw.Write([]byte("data"))
+	if h.Count() != 1 || h.Max() <= 0 {
+		t.Fatal("histogram should be usable with MeteredWriter")
+	}
+}
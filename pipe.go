@@ -0,0 +1,14 @@
+package meteredwriter
+
+import "io"
+
+// NewMeteredPipe creates an in-memory pipe with io.Pipe, attaching provided
+// histogram to its write end as NewMeteredWriter does. As each write blocks
+// until reader consumes it, sampled latency reflects consumer speed, which is
+// useful to benchmark consumers. Closing returned MeteredWriter closes write
+// end of the pipe; use Unwrap to get *io.PipeWriter, e.g. to call its
+// CloseWithError method.
+func NewMeteredPipe(h Histogram, opts ...Option) (MeteredWriter, *io.PipeReader) {
+	pr, pw := io.Pipe()
+	return NewMeteredWriter(pw, h, opts...), pr
+}
@@ -0,0 +1,38 @@
+package meteredwriter
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestNewMeteredPipe(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw, pr := NewMeteredPipe(histogram)
+	done := make(chan int64)
+	go func() {
+		time.Sleep(20 * time.Millisecond) // slow consumer
+		n, _ := io.Copy(ioutil.Discard, pr)
+		done <- n
+	}()
+	for i := 0; i < 3; i++ {
+		if _, err := mw.Write([]byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-done; n != 12 {
+		t.Fatal("reader should get all data, got bytes:", n)
+	}
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+	if d := time.Duration(histogram.Max()); d < 20*time.Millisecond {
+		t.Fatal("latency should reflect consumer speed, got:", d)
+	}
+}
@@ -0,0 +1,64 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// PoolMeteredWriter meters writes to destinations acquired from a pool (e.g.
+// connection pool with blocking get) on each write. Time spent acquiring
+// writer is part of user-perceived write latency, so it is sampled to a
+// separate histogram, which exposes pool contention.
+type PoolMeteredWriter struct {
+	acquire     func() (io.Writer, func())
+	acquireHist Histogram
+	writeHist   Histogram
+}
+
+// NewPoolMeteredWriter returns PoolMeteredWriter calling acquire to get writer
+// and its release function for each write. Time spent in acquire is sampled to
+// acquireHist, write latency is sampled to writeHist; both are stored in
+// nanoseconds. If histograms implement Registrar interface, this would also
+// call their Register() methods.
+func NewPoolMeteredWriter(acquire func() (io.Writer, func()), acquireHist, writeHist Histogram) PoolMeteredWriter {
+	register(acquireHist, writeHist)
+	return PoolMeteredWriter{
+		acquire:     acquire,
+		acquireHist: acquireHist,
+		writeHist:   writeHist,
+	}
+}
+
+// AcquireHistogram returns histogram sampling writer acquisition latency.
+func (w PoolMeteredWriter) AcquireHistogram() Histogram { return w.acquireHist }
+
+// WriteHistogram returns histogram sampling write latency.
+func (w PoolMeteredWriter) WriteHistogram() Histogram { return w.writeHist }
+
+// Write implements io.Writer interface. It acquires writer, writes p to it
+// and releases writer. Acquisition is always sampled, write only if it is
+// non-empty. Release function, if not nil, is called even if write fails.
+func (w PoolMeteredWriter) Write(p []byte) (n int, err error) {
+	start := time.Now()
+	dst, release := w.acquire()
+	if release != nil {
+		defer release()
+	}
+	acquired := time.Now()
+	if w.acquireHist != nil {
+		w.acquireHist.Update(acquired.Sub(start).Nanoseconds())
+	}
+	n, err = dst.Write(p)
+	if n > 0 && w.writeHist != nil {
+		w.writeHist.Update(time.Now().Sub(acquired).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If attached histograms implement
+// Registrar interface, this would call their Done() methods. Pooled writers
+// are not closed.
+func (w PoolMeteredWriter) Close() error {
+	done(w.acquireHist, w.writeHist)
+	return nil
+}
@@ -0,0 +1,52 @@
+package meteredwriter
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestPoolMeteredWriter(t *testing.T) {
+	errFailed := errors.New("write failed")
+	pool := make(chan io.Writer, 1)
+	pool <- errWriter{n: 4}
+	var released int
+	acquire := func() (io.Writer, func()) {
+		w := <-pool
+		return w, func() { released++; pool <- w }
+	}
+	acquireHist := metrics.NewHistogram(metrics.NewUniformSample(100))
+	writeHist := metrics.NewHistogram(metrics.NewUniformSample(100))
+	w := NewPoolMeteredWriter(acquire, acquireHist, writeHist)
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatal("write error:", err)
+	}
+
+	t.Log("taking pooled writer to simulate contention")
+	<-pool
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pool <- errWriter{err: errFailed}
+	}()
+	if _, err := w.Write([]byte("data")); err != errFailed {
+		t.Fatal("unexpected write error:", err)
+	}
+	if released != 2 {
+		t.Fatal("writer should be released after each write, got:", released)
+	}
+	if cnt := acquireHist.Count(); cnt != 2 {
+		t.Fatal("should have 2 acquire samples, got:", cnt)
+	}
+	if max := time.Duration(acquireHist.Max()); max < 20*time.Millisecond {
+		t.Fatal("acquire histogram should reflect pool contention, got:", max)
+	}
+	if cnt := writeHist.Count(); cnt != 1 {
+		t.Fatal("should have 1 write sample, got:", cnt)
+	}
+	if w.AcquireHistogram() != acquireHist || w.WriteHistogram() != writeHist {
+		t.Fatal("accessors should return attached histograms")
+	}
+}
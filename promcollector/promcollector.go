@@ -0,0 +1,57 @@
+// Package promcollector provides Prometheus collector exposing
+// meteredwriter.Histogram statistics.
+//
+// It is kept separate from meteredwriter package so that meteredwriter does
+// not depend on Prometheus client library.
+package promcollector
+
+import (
+	"time"
+
+	"github.com/artyom/meteredwriter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements prometheus.Collector interface, exposing histogram
+// holding latency samples in nanoseconds as Prometheus summary with 50th, 90th
+// and 99th percentiles, sample count and sum. Following Prometheus
+// conventions, latency values are reported in seconds.
+//
+// Note that count and sum only describe samples currently held by histogram:
+// unlike Prometheus summary expects, they are not monotonic and drop whenever
+// histogram is cleared (e.g. by meteredwriter.SelfCleaningHistogram), so
+// rate() over them gives bogus results around clears. Sum is estimated as
+// mean times count, since Histogram interface does not expose exact sum.
+// Percentiles are the values meant to be graphed.
+type Collector struct {
+	desc *prometheus.Desc
+	h    meteredwriter.Histogram
+}
+
+// NewCollector returns Collector exposing h as summary metric with given
+// name and help string. It is named after the package, rather than
+// NewPrometheusCollector, so that call sites read as promcollector.NewCollector;
+// help string is required by Prometheus for each metric.
+func NewCollector(name, help string, h meteredwriter.Histogram) *Collector {
+	return &Collector{
+		desc: prometheus.NewDesc(name, help, nil, nil),
+		h:    h,
+	}
+}
+
+// Describe implements prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+
+// Collect implements prometheus.Collector interface. Histogram statistics are
+// captured with meteredwriter.Snapshot on each call.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := meteredwriter.Snapshot(c.h)
+	ch <- prometheus.MustNewConstSummary(c.desc,
+		uint64(s.Count),
+		s.Mean*float64(s.Count)/float64(time.Second),
+		map[float64]float64{
+			0.5:  s.P50 / float64(time.Second),
+			0.9:  s.P90 / float64(time.Second),
+			0.99: s.P99 / float64(time.Second),
+		})
+}
@@ -0,0 +1,45 @@
+package promcollector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollector(t *testing.T) {
+	h := metrics.NewHistogram(metrics.NewUniformSample(100))
+	for _, d := range []time.Duration{time.Millisecond, 3 * time.Millisecond} {
+		h.Update(d.Nanoseconds())
+	}
+	var c prometheus.Collector = NewCollector("write_latency_seconds", "Write latency.", h)
+	descs := make(chan *prometheus.Desc, 1)
+	c.Describe(descs)
+	if len(descs) != 1 {
+		t.Fatal("collector should describe one metric")
+	}
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	s := m.GetSummary()
+	if s.GetSampleCount() != 2 {
+		t.Fatal("unexpected sample count:", s.GetSampleCount())
+	}
+	if sum := s.GetSampleSum(); sum < 0.00399 || sum > 0.00401 {
+		t.Fatal("unexpected sample sum:", sum)
+	}
+	for _, q := range s.GetQuantile() {
+		t.Logf("p%v: %v", q.GetQuantile()*100, q.GetValue())
+		if q.GetQuantile() == 0.5 && q.GetValue() != 0.002 {
+			t.Fatal("unexpected median:", q.GetValue())
+		}
+	}
+	if n := len(s.GetQuantile()); n != 3 {
+		t.Fatal("want 3 quantiles, got:", n)
+	}
+}
@@ -0,0 +1,137 @@
+package meteredwriter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned by QuotaWriter for writes exceeding its byte
+// quota.
+var ErrQuotaExceeded = errors.New("meteredwriter: write quota exceeded")
+
+// QuotaMode defines how QuotaWriter handles a write exceeding its quota.
+type QuotaMode int
+
+const (
+	// RejectOverQuota rejects the whole write exceeding quota: nothing is
+	// written.
+	RejectOverQuota QuotaMode = iota
+	// TruncateOverQuota writes as many bytes of the write exceeding quota
+	// as quota allows.
+	TruncateOverQuota
+)
+
+// QuotaWriter is a MeteredWriter enforcing a quota on the total number of
+// bytes written (e.g. per-tenant daily limit). Once quota is reached, writes
+// fail with ErrQuotaExceeded. Latency of accepted bytes is sampled as usual.
+// QuotaWriter is safe for concurrent use if underlying writer is.
+type QuotaWriter struct {
+	MeteredWriter
+	quota    int64
+	mode     QuotaMode
+	exceeded Counter
+
+	mu   sync.Mutex
+	used int64
+}
+
+// NewQuotaWriter attaches provided histogram to writer as NewMeteredWriter
+// does, limiting total number of bytes written to quota. Write exceeding quota
+// is handled according to mode and increments exceeded counter, which may be
+// nil.
+func NewQuotaWriter(writer io.Writer, h Histogram, quota int64, mode QuotaMode, exceeded Counter, opts ...Option) *QuotaWriter {
+	return &QuotaWriter{
+		MeteredWriter: NewMeteredWriter(writer, h, opts...),
+		quota:         quota,
+		mode:          mode,
+		exceeded:      exceeded,
+	}
+}
+
+// NewLimitedMeteredWriter returns QuotaWriter which writes at most limit bytes
+// in total to writer: write crossing the limit is truncated to fit, and it and
+// all further writes fail with ErrQuotaExceeded. Latency of partial write is
+// sampled as usual. It is a shortcut for NewQuotaWriter in TruncateOverQuota
+// mode.
+func NewLimitedMeteredWriter(writer io.Writer, h Histogram, limit int64, opts ...Option) *QuotaWriter {
+	return NewQuotaWriter(writer, h, limit, TruncateOverQuota, nil, opts...)
+}
+
+// Remaining returns number of bytes that can still be written.
+func (w *QuotaWriter) Remaining() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.used >= w.quota {
+		return 0
+	}
+	return w.quota - w.used
+}
+
+// Write implements io.Writer interface. Writes fitting into remaining quota
+// are passed to MeteredWriter. Write exceeding quota returns ErrQuotaExceeded:
+// in RejectOverQuota mode nothing is written, in TruncateOverQuota mode
+// as much of p as quota allows is written first.
+func (w *QuotaWriter) Write(p []byte) (n int, err error) {
+	return w.write(p, w.MeteredWriter.Write)
+}
+
+// WriteContext writes p as MeteredWriter.WriteContext does, applying quota the
+// same way Write does.
+func (w *QuotaWriter) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	return w.write(p, func(p []byte) (int, error) {
+		return w.MeteredWriter.WriteContext(ctx, p)
+	})
+}
+
+// write reserves quota for p and passes allowed part of it to fn.
+func (w *QuotaWriter) write(p []byte, fn func([]byte) (int, error)) (n int, err error) {
+	w.mu.Lock()
+	allowed := len(p)
+	remaining := w.quota - w.used
+	over := int64(len(p)) > remaining
+	if over {
+		if w.mode != TruncateOverQuota || remaining <= 0 {
+			w.mu.Unlock()
+			w.exceed()
+			return 0, ErrQuotaExceeded
+		}
+		allowed = int(remaining)
+	}
+	// reserve quota so that concurrent writes cannot exceed it
+	w.used += int64(allowed)
+	w.mu.Unlock()
+	n, err = fn(p[:allowed])
+	if n < allowed {
+		w.mu.Lock()
+		w.used -= int64(allowed - n)
+		w.mu.Unlock()
+	}
+	if over {
+		w.exceed()
+		if err == nil {
+			err = ErrQuotaExceeded
+		}
+	}
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom interface, copying data with Write method,
+// so that quota cannot be bypassed by io.Copy calling MeteredWriter's
+// ReadFrom method.
+func (w *QuotaWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	return io.Copy(writerOnly{w}, r)
+}
+
+// WriteString implements io.StringWriter interface, passing s to Write method,
+// so that quota applies.
+func (w *QuotaWriter) WriteString(s string) (n int, err error) {
+	return w.Write([]byte(s))
+}
+
+func (w *QuotaWriter) exceed() {
+	if w.exceeded != nil {
+		w.exceeded.Inc(1)
+	}
+}
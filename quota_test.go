@@ -0,0 +1,105 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestQuotaWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mode    QuotaMode
+		written string
+		n       int
+	}{
+		{"reject", RejectOverQuota, "abcd", 0},
+		{"truncate", TruncateOverQuota, "abcdef", 2},
+	} {
+		histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+		exceeded := new(testCounter)
+		buf := new(bytes.Buffer)
+		w := NewQuotaWriter(buf, histogram, 6, tc.mode, exceeded)
+		if n, err := w.Write([]byte("abcd")); n != 4 || err != nil {
+			t.Fatalf("%s: write within quota should succeed, got %d, %v", tc.name, n, err)
+		}
+		if r := w.Remaining(); r != 2 {
+			t.Fatalf("%s: should have 2 bytes remaining, got %d", tc.name, r)
+		}
+		if n, err := w.Write([]byte("efgh")); n != tc.n || err != ErrQuotaExceeded {
+			t.Fatalf("%s: write over quota: want %d, ErrQuotaExceeded, got %d, %v",
+				tc.name, tc.n, n, err)
+		}
+		if buf.String() != tc.written {
+			t.Fatalf("%s: unexpected data written: %q", tc.name, buf)
+		}
+		if w.Remaining() != int64(6-buf.Len()) {
+			t.Fatalf("%s: unexpected remaining quota: %d", tc.name, w.Remaining())
+		}
+		if _, err := w.Write(make([]byte, w.Remaining())); err != nil {
+			t.Fatalf("%s: write of remaining quota should succeed, got %v", tc.name, err)
+		}
+		if n, err := w.Write([]byte("x")); n != 0 || err != ErrQuotaExceeded {
+			t.Fatalf("%s: write after quota is exhausted should fail, got %d, %v", tc.name, n, err)
+		}
+		if r := w.Remaining(); r != 0 || buf.Len() != 6 {
+			t.Fatalf("%s: quota should be exhausted, remaining %d, written %d", tc.name, r, buf.Len())
+		}
+		if cnt := exceeded.Count(); cnt != 2 {
+			t.Fatalf("%s: should have 2 quota exceeded events, got %d", tc.name, cnt)
+		}
+		if cnt := histogram.Count(); cnt != 2 {
+			t.Fatalf("%s: should have 2 registered samples, got %d", tc.name, cnt)
+		}
+	}
+}
+
+func TestQuotaWriter_ShortWrite(t *testing.T) {
+	w := NewQuotaWriter(shortWriter{max: 2}, nil, 10, RejectOverQuota, nil)
+	w.Write([]byte("abcd"))
+	if r := w.Remaining(); r != 8 {
+		t.Fatal("bytes not written should not use quota, remaining:", r)
+	}
+}
+
+func TestQuotaWriter_ReadFrom(t *testing.T) {
+	// ioutil.Discard implements io.ReaderFrom, which must not bypass quota
+	w := NewQuotaWriter(ioutil.Discard, nil, 100, TruncateOverQuota, nil)
+	src := io.LimitReader(strings.NewReader(strings.Repeat("x", 1000)), 1000)
+	n, err := io.Copy(w, src)
+	if err != ErrQuotaExceeded || n != 100 {
+		t.Fatalf("want 100 bytes copied and ErrQuotaExceeded, got %d, %v", n, err)
+	}
+}
+
+func TestQuotaWriter_WriteString(t *testing.T) {
+	w := NewQuotaWriter(new(bytes.Buffer), nil, 3, RejectOverQuota, nil)
+	if _, err := io.WriteString(w, "abcd"); err != ErrQuotaExceeded {
+		t.Fatal("want ErrQuotaExceeded, got:", err)
+	}
+}
+
+func TestNewLimitedMeteredWriter(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	buf := new(bytes.Buffer)
+	w := NewLimitedMeteredWriter(buf, histogram, 6)
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]byte("data")); n != 2 || err != ErrQuotaExceeded {
+		t.Fatalf("write crossing limit should be truncated, got %d, %v", n, err)
+	}
+	if n, err := w.Write([]byte("data")); n != 0 || err != ErrQuotaExceeded {
+		t.Fatalf("write past limit should be rejected, got %d, %v", n, err)
+	}
+	if buf.String() != "datada" || w.Remaining() != 0 {
+		t.Fatalf("unexpected data written: %q, remaining %d", buf.String(), w.Remaining())
+	}
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("partial write should be sampled, got samples:", cnt)
+	}
+}
@@ -0,0 +1,100 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// MeteredReader wraps io.Reader and registers each read operation latency in
+// attached histogram
+type MeteredReader struct {
+	io.Reader
+	h Histogram
+}
+
+// NewMeteredReader attaches provided histogram to reader, returning new
+// io.Reader. If histogram implements Registrar interface, this would also call
+// its Register() method.
+func NewMeteredReader(reader io.Reader, h Histogram) MeteredReader {
+	register(h)
+	return MeteredReader{
+		Reader: reader,
+		h:      h,
+	}
+}
+
+// Read implements io.Reader interface; each non-empty read operation is timed
+// and sampled in attached histogram. Samples are stored in nanoseconds.
+func (mr MeteredReader) Read(p []byte) (n int, err error) {
+	var start time.Time
+	if mr.h != nil {
+		start = time.Now()
+	}
+	n, err = mr.Reader.Read(p)
+	if n > 0 && mr.h != nil {
+		mr.h.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying reader implements
+// io.Closer, calling this method would also close it. If attached histogram
+// also implements Registrar interface, this would call its Done() method.
+func (mr MeteredReader) Close() error {
+	done(mr.h)
+	if c, ok := mr.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// MeteredReadWriter wraps io.ReadWriter like net.Conn and registers latency
+// of read and write operations in separate histograms.
+type MeteredReadWriter struct {
+	io.ReadWriter
+	readH, writeH Histogram
+}
+
+// NewMeteredReadWriter attaches provided histograms to rw, sampling read
+// latency to readH and write latency to writeH; either histogram may be nil.
+// If histograms implement Registrar interface, this would also call their
+// Register() methods.
+func NewMeteredReadWriter(rw io.ReadWriter, readH, writeH Histogram) MeteredReadWriter {
+	register(readH, writeH)
+	return MeteredReadWriter{
+		ReadWriter: rw,
+		readH:      readH,
+		writeH:     writeH,
+	}
+}
+
+// Read implements io.Reader interface; each non-empty read operation is timed
+// and sampled in read histogram. Samples are stored in nanoseconds.
+func (mrw MeteredReadWriter) Read(p []byte) (n int, err error) {
+	return MeteredReader{Reader: mrw.ReadWriter, h: mrw.readH}.Read(p)
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled in write histogram. Samples are stored in nanoseconds.
+func (mrw MeteredReadWriter) Write(p []byte) (n int, err error) {
+	var start time.Time
+	if mrw.writeH != nil {
+		start = time.Now()
+	}
+	n, err = mrw.ReadWriter.Write(p)
+	if n > 0 && mrw.writeH != nil {
+		mrw.writeH.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying ReadWriter implements
+// io.Closer, calling this method would also close it. If attached histograms
+// implement Registrar interface, this would call their Done() methods.
+func (mrw MeteredReadWriter) Close() error {
+	done(mrw.readH, mrw.writeH)
+	if c, ok := mrw.ReadWriter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredReader(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mr := NewMeteredReader(io.LimitReader(bytes.NewReader(make([]byte, 1<<16)), 1<<16), histogram)
+	n, err := io.Copy(ioutil.Discard, mr)
+	if err != nil {
+		t.Fatal("failed to copy data:", err)
+	}
+	t.Log("bytes copied:", n)
+	t.Logf("%d reads, latency min: %s, max: %s",
+		histogram.Count(),
+		time.Duration(histogram.Min()),
+		time.Duration(histogram.Max()))
+	if histogram.Count() == 0 {
+		t.Fatal("histogram should have some registered samples")
+	}
+	cnt := histogram.Count()
+	mr.Read(make([]byte, 10)) // EOF, nothing read
+	if histogram.Count() != cnt {
+		t.Fatal("empty reads should not be sampled")
+	}
+}
+
+func TestMeteredReader_Close(t *testing.T) {
+	h := &registrarHistogram{Histogram: metrics.NewHistogram(metrics.NewUniformSample(100))}
+	c := &closeWriter{}
+	mr := NewMeteredReader(struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(nil), c}, h)
+	if err := mr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.closed != 1 {
+		t.Fatal("underlying reader should be closed")
+	}
+	if h.registered != 1 || h.done != 1 || h.shutdown != 0 {
+		t.Fatalf("histogram should be registered and released once, got %d Register, %d Done, %d Shutdown calls",
+			h.registered, h.done, h.shutdown)
+	}
+}
+
+func TestMeteredReadWriter(t *testing.T) {
+	readH := metrics.NewHistogram(metrics.NewUniformSample(100))
+	writeH := metrics.NewHistogram(metrics.NewUniformSample(100))
+	buf := new(bytes.Buffer)
+	rw := NewMeteredReadWriter(buf, readH, writeH)
+	for i := 0; i < 3; i++ {
+		if _, err := rw.Write([]byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := io.ReadFull(rw, make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+	if writeH.Count() != 3 || readH.Count() != 1 {
+		t.Fatalf("want 3 write and 1 read samples, got %d and %d",
+			writeH.Count(), readH.Count())
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
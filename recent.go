@@ -0,0 +1,104 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Record describes a single write operation kept by RecentWriter; it is the
+// same type as SlowWrite reported by SlowestWriter.
+type Record = SlowWrite
+
+// RecentWriter wraps io.Writer and keeps records of recent non-empty writes in
+// a circular buffer, which can be queried by time range; this is a lightweight
+// in-process trace useful for short-horizon debugging of latency spikes.
+// Memory is bounded both by number of records and by retention period: older
+// records are dropped. RecentWriter is safe for concurrent use.
+type RecentWriter struct {
+	io.Writer
+	retention time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	ring  []Record
+	first int // index of the oldest record
+	size  int // number of records held
+}
+
+// NewRecentWriter returns RecentWriter wrapping writer, keeping up to size
+// records no older than retention. Non-positive retention disables time-based
+// expiration. size is clamped to be at least 1.
+func NewRecentWriter(writer io.Writer, size int, retention time.Duration) *RecentWriter {
+	if size < 1 {
+		size = 1
+	}
+	return &RecentWriter{
+		Writer:    writer,
+		retention: retention,
+		now:       time.Now,
+		ring:      make([]Record, size),
+	}
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and recorded.
+func (w *RecentWriter) Write(p []byte) (n int, err error) {
+	start := w.now()
+	n, err = w.Writer.Write(p)
+	if n > 0 {
+		end := w.now()
+		w.add(Record{Time: start, Duration: end.Sub(start), Bytes: n}, end)
+	}
+	return n, err
+}
+
+// Range returns records of writes started within [from, to) range, oldest
+// first.
+func (w *RecentWriter) Range(from, to time.Time) []Record {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expire(w.now())
+	var out []Record
+	for i := 0; i < w.size; i++ {
+		r := w.ring[(w.first+i)%len(w.ring)]
+		if !r.Time.Before(from) && r.Time.Before(to) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it.
+func (w *RecentWriter) Close() error {
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *RecentWriter) add(r Record, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expire(now)
+	if w.size == len(w.ring) {
+		w.first = (w.first + 1) % len(w.ring)
+		w.size--
+	}
+	w.ring[(w.first+w.size)%len(w.ring)] = r
+	w.size++
+}
+
+// expire drops records older than retention. Must be called with mu held.
+func (w *RecentWriter) expire(now time.Time) {
+	if w.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-w.retention)
+	for w.size > 0 && w.ring[w.first].Time.Before(cutoff) {
+		w.ring[w.first] = Record{}
+		w.first = (w.first + 1) % len(w.ring)
+		w.size--
+	}
+}
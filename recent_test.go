@@ -0,0 +1,60 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecentWriter(t *testing.T) {
+	clock := newFakeClock()
+	w := NewRecentWriter(&slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}},
+		3, 10*time.Second)
+	w.now = clock.Now
+	t0 := clock.Now()
+	for i := 1; i <= 4; i++ {
+		w.Write(make([]byte, i))
+		clock.Advance(time.Second)
+	}
+	got := w.Range(t0, clock.Now())
+	if len(got) != 3 {
+		t.Fatal("records should be bounded by size, got:", len(got))
+	}
+	for i, r := range got {
+		if r.Bytes != i+2 || r.Duration != time.Millisecond {
+			t.Fatalf("unexpected record #%d: %+v", i, r)
+		}
+	}
+	if got := w.Range(t0.Add(2*time.Second), t0.Add(3*time.Second)); len(got) != 1 || got[0].Bytes != 3 {
+		t.Fatalf("unexpected records in range: %+v", got)
+	}
+	clock.Advance(8 * time.Second)
+	if got := w.Range(t0, clock.Now()); len(got) != 1 || got[0].Bytes != 4 {
+		t.Fatalf("records older than retention should be dropped, got: %+v", got)
+	}
+}
+
+func TestRecentWriter_Concurrent(t *testing.T) {
+	w := NewRecentWriter(ioutil.Discard, 100, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				w.Write([]byte("data"))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.Range(time.Now().Add(-time.Second), time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+	if got := w.Range(time.Time{}, time.Now().Add(time.Second)); len(got) != 100 {
+		t.Fatal("should hold 100 records, got:", len(got))
+	}
+}
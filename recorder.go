@@ -0,0 +1,131 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// Recorder interface is a minimal sink for write samples: Observe is called
+// with write latency in nanoseconds and number of bytes written. It decouples
+// MeteredWriter from histogram-shaped sinks, see NewRecordingWriter.
+type Recorder interface {
+	Observe(value int64, size int)
+}
+
+// RecorderFunc is an adapter to allow the use of ordinary functions as
+// Recorder.
+type RecorderFunc func(value int64, size int)
+
+// Observe calls f(value, size).
+func (f RecorderFunc) Observe(value int64, size int) { f(value, size) }
+
+// Meter interface wraps a subset of methods of metrics.Meter interface so it
+// can be used without type conversion.
+type Meter interface {
+	Count() int64
+	Mark(int64)
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+}
+
+// Timer interface wraps a subset of methods of metrics.Timer interface so it
+// can be used without type conversion.
+type Timer interface {
+	Count() int64
+	Update(time.Duration)
+	UpdateSince(time.Time)
+}
+
+// HistogramRecorder returns Recorder adding latency values to h.
+func HistogramRecorder(h Histogram) Recorder { return histogramRecorder{h} }
+
+// PerByteRecorder returns Recorder adding latency per byte written (latency
+// divided by number of bytes) to h, which makes writes of different sizes
+// comparable.
+func PerByteRecorder(h Histogram) Recorder { return perByteRecorder{h} }
+
+// CounterRecorder returns Recorder incrementing c by number of bytes written.
+func CounterRecorder(c Counter) Recorder { return counterRecorder{c} }
+
+// MeterRecorder returns Recorder marking m with number of bytes written, so
+// that meter reports throughput in bytes per second.
+func MeterRecorder(m Meter) Recorder { return meterRecorder{m} }
+
+// TimerRecorder returns Recorder updating t with write latency, so that timer
+// reports both latency distribution and rate of writes. Timer is always
+// updated with actual write duration: WithUnit and WithRounding options do not
+// apply to it.
+func TimerRecorder(t Timer) Recorder { return timerRecorder{t} }
+
+// MultiRecorder returns Recorder passing each sample to all of rs. Nil
+// recorders are skipped.
+func MultiRecorder(rs ...Recorder) Recorder {
+	var m multiRecorder
+	for _, r := range rs {
+		if r != nil {
+			m = append(m, r)
+		}
+	}
+	return m
+}
+
+// NewTimedWriter attaches provided timer to writer, returning new io.Writer
+// which updates t with latency of each non-empty write, so that timer's meter
+// reports writes per second next to latency distribution. It is a shortcut for
+// NewRecordingWriter with TimerRecorder.
+func NewTimedWriter(writer io.Writer, t Timer, opts ...Option) MeteredWriter {
+	return NewRecordingWriter(writer, TimerRecorder(t), opts...)
+}
+
+// Observe implements Recorder interface, adding value to each histogram.
+func (m *MultiHistogram) Observe(value int64, _ int) { m.Update(value) }
+
+type histogramRecorder struct{ h Histogram }
+
+func (r histogramRecorder) Observe(value int64, _ int) { r.h.Update(value) }
+
+type perByteRecorder struct{ h Histogram }
+
+func (r perByteRecorder) Observe(value int64, size int) {
+	if size > 0 {
+		r.h.Update(value / int64(size))
+	}
+}
+
+type counterRecorder struct{ c Counter }
+
+func (r counterRecorder) Observe(_ int64, size int) { r.c.Inc(int64(size)) }
+
+type meterRecorder struct{ m Meter }
+
+func (r meterRecorder) Observe(_ int64, size int) { r.m.Mark(int64(size)) }
+
+type timerRecorder struct{ t Timer }
+
+func (r timerRecorder) Observe(value int64, _ int) { r.t.Update(time.Duration(value)) }
+
+// observe passes sample of write of size bytes which took d to r; value is d
+// converted by options. Timers are given d itself, as they expect durations
+// rather than values in arbitrary units.
+func observe(r Recorder, d time.Duration, value int64, size int) {
+	switch r := r.(type) {
+	case timerRecorder:
+		r.t.Update(d)
+	case multiRecorder:
+		for _, r := range r {
+			observe(r, d, value, size)
+		}
+	default:
+		r.Observe(value, size)
+	}
+}
+
+type multiRecorder []Recorder
+
+func (m multiRecorder) Observe(value int64, size int) {
+	for _, r := range m {
+		r.Observe(value, size)
+	}
+}
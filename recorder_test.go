@@ -0,0 +1,106 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestRecorderAdapters(t *testing.T) {
+	clock := newFakeClock()
+	w := &slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}}
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	counter := new(testCounter)
+	meter := new(testMeter)
+	multi := NewMultiHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)))
+	var values []int64
+	fn := RecorderFunc(func(value int64, size int) { values = append(values, value) })
+	mw := NewRecordingWriter(w, MultiRecorder(
+		HistogramRecorder(histogram),
+		CounterRecorder(counter),
+		MeterRecorder(meter),
+		multi,
+		fn,
+		nil,
+	), WithClock(clock.Now))
+	for _, s := range []string{"abc", "", "abcdefg"} {
+		if _, err := mw.Write([]byte(s)); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if cnt := histogram.Count(); cnt != 2 || histogram.Max() != time.Millisecond.Nanoseconds() {
+		t.Fatalf("histogram recorder: unexpected samples: %d, max %d", cnt, histogram.Max())
+	}
+	if cnt := counter.Count(); cnt != 10 {
+		t.Fatal("counter recorder should count bytes written, got:", cnt)
+	}
+	if cnt := meter.Count(); cnt != 10 {
+		t.Fatal("meter recorder should mark bytes written, got:", cnt)
+	}
+	if cnt := multi.Count(); cnt != 2 {
+		t.Fatal("multi histogram recorder: unexpected number of samples:", cnt)
+	}
+	if len(values) != 2 || values[0] != time.Millisecond.Nanoseconds() {
+		t.Fatal("recorder func: unexpected values:", values)
+	}
+}
+
+// registrarRecorder is a Recorder implementing Registrar interface.
+type registrarRecorder struct {
+	RecorderFunc
+	registered, done, shutdown int
+}
+
+func (r *registrarRecorder) Register() { r.registered++ }
+func (r *registrarRecorder) Done()     { r.done++ }
+func (r *registrarRecorder) Shutdown() { r.shutdown++ }
+
+func TestNewRecordingWriter_Registrar(t *testing.T) {
+	r := &registrarRecorder{RecorderFunc: func(int64, int) {}}
+	mw := NewRecordingWriter(ioutil.Discard, r)
+	if r.registered != 1 || r.done != 0 {
+		t.Fatal("recorder should be registered on writer creation")
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal("metered writer close error:", err)
+	}
+	if r.registered != 1 || r.done != 1 || r.shutdown != 0 {
+		t.Fatal("recorder should be released on writer close")
+	}
+}
+
+// testTimer is a Timer keeping all durations it was updated with.
+type testTimer struct{ values []time.Duration }
+
+func (t *testTimer) Count() int64             { return int64(len(t.values)) }
+func (t *testTimer) Update(d time.Duration)   { t.values = append(t.values, d) }
+func (t *testTimer) UpdateSince(ts time.Time) { t.Update(time.Since(ts)) }
+
+func TestNewTimedWriter(t *testing.T) {
+	clock := newFakeClock()
+	timer := new(testTimer)
+	mw := NewTimedWriter(&slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}},
+		timer, WithClock(clock.Now))
+	for _, s := range []string{"abc", "", "abcdefg"} {
+		mw.Write([]byte(s))
+	}
+	if cnt := timer.Count(); cnt != 2 {
+		t.Fatal("timer should be updated on each non-empty write, got:", cnt)
+	}
+	if d := timer.values[0]; d != time.Millisecond {
+		t.Fatal("unexpected timer value:", d)
+	}
+}
+
+func TestNewTimedWriter_Unit(t *testing.T) {
+	clock := newFakeClock()
+	timer := new(testTimer)
+	mw := NewTimedWriter(&slowWriter{clock: clock, delays: []time.Duration{1500 * time.Microsecond}},
+		timer, WithClock(clock.Now), WithUnit(time.Millisecond), WithRounding(time.Millisecond))
+	mw.Write([]byte("abc"))
+	if cnt := timer.Count(); cnt != 1 || timer.values[0] != 1500*time.Microsecond {
+		t.Fatal("timer should be updated with actual duration, got:", timer.values)
+	}
+}
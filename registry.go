@@ -0,0 +1,78 @@
+package meteredwriter
+
+import (
+	"fmt"
+	"io"
+)
+
+// Registry interface wraps a subset of methods of metrics.Registry interface
+// so it can be used without type conversion.
+type Registry interface {
+	GetOrRegister(string, interface{}) interface{}
+}
+
+// Unregisterer is implemented by registries which can remove metrics, like
+// metrics.Registry.
+type Unregisterer interface {
+	Unregister(string)
+}
+
+// NewRegisteredMeteredWriter gets histogram registered in r under name,
+// registering one created by newHistogram if there's none, and attaches it to
+// writer as NewMeteredWriter does. newHistogram is only called if histogram has
+// to be registered, e.g.:
+//
+//	mw, err := NewRegisteredMeteredWriter("writes", metrics.DefaultRegistry,
+//		conn, func() Histogram {
+//			return metrics.NewHistogram(metrics.NewUniformSample(1028))
+//		})
+//
+// It returns an error if some other metric type is already registered under
+// name.
+//
+// Unlike metrics.GetOrRegisterHistogram, histogram is created by newHistogram
+// rather than by registry, as this package does not depend on go-metrics; for
+// the same reason name clash is reported as an error instead of a panic.
+// Note that metrics.Registry only stores metrics of its own types: histogram
+// of a custom type, e.g. SelfCleaningHistogram, is attached to writer but not
+// registered, so each call creates a new, unshared histogram. Register such
+// histograms once and share them explicitly instead.
+func NewRegisteredMeteredWriter(name string, r Registry, writer io.Writer, newHistogram func() Histogram, opts ...Option) (MeteredWriter, error) {
+	h, err := getOrRegisterHistogram(name, r, newHistogram)
+	if err != nil {
+		return MeteredWriter{}, err
+	}
+	return NewMeteredWriter(writer, h, opts...), nil
+}
+
+func getOrRegisterHistogram(name string, r Registry, newHistogram func() Histogram) (Histogram, error) {
+	// registry calls provided function lazily only if name is not registered
+	// yet, see metrics.Registry.GetOrRegister
+	m := r.GetOrRegister(name, newHistogram)
+	h, ok := m.(Histogram)
+	if !ok {
+		return nil, fmt.Errorf("metric %q already registered as %T", name, m)
+	}
+	return h, nil
+}
+
+// NewMeteredWriterNamed is like NewRegisteredMeteredWriter, taking registry
+// first. If WithUnregister option is given and r implements Unregisterer, name
+// is unregistered from r on MeteredWriter.Close; as histogram is shared by all
+// writers using the same name, this is only safe if name is unique to writer.
+func NewMeteredWriterNamed(r Registry, name string, writer io.Writer, newHistogram func() Histogram, opts ...Option) (MeteredWriter, error) {
+	if u, ok := r.(Unregisterer); ok {
+		opts = append(opts[:len(opts):len(opts)], func(o *options) {
+			if o.unregister {
+				o.addStop(func() { u.Unregister(name) })
+			}
+		})
+	}
+	return NewRegisteredMeteredWriter(name, r, writer, newHistogram, opts...)
+}
+
+// WithUnregister makes MeteredWriter created with NewMeteredWriterNamed
+// unregister its histogram on Close. It has no effect on other constructors.
+func WithUnregister() Option {
+	return func(o *options) { o.unregister = true }
+}
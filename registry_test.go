@@ -0,0 +1,116 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+// testRegistry mimics metrics.Registry lazy initialization semantics; like
+// metrics.Registry, it only stores histograms of metrics package.
+type testRegistry struct {
+	mu sync.Mutex
+	m  map[string]interface{}
+}
+
+func (r *testRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.m[name]; ok {
+		return v
+	}
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+	}
+	if _, ok := i.(Histogram); ok {
+		if _, ok := i.(metrics.Histogram); !ok {
+			return i
+		}
+	}
+	if r.m == nil {
+		r.m = make(map[string]interface{})
+	}
+	r.m[name] = i
+	return i
+}
+
+func TestNewRegisteredMeteredWriter(t *testing.T) {
+	r := new(testRegistry)
+	var created int
+	newHistogram := func() Histogram {
+		created++
+		return metrics.NewHistogram(metrics.NewUniformSample(100))
+	}
+	mw1, err := NewRegisteredMeteredWriter("writes", r, ioutil.Discard, newHistogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw2, err := NewRegisteredMeteredWriter("writes", r, ioutil.Discard, newHistogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 {
+		t.Fatal("histogram should be created exactly once, got:", created)
+	}
+	mw1.Write([]byte("data"))
+	mw2.Write([]byte("data"))
+	h := r.GetOrRegister("writes", nil).(Histogram)
+	if cnt := h.Count(); cnt != 2 {
+		t.Fatal("shared histogram should have 2 samples, got:", cnt)
+	}
+	r.GetOrRegister("counter", new(testCounter))
+	if _, err := NewRegisteredMeteredWriter("counter", r, ioutil.Discard, newHistogram); err == nil {
+		t.Fatal("registering writer over metric of different type should fail")
+	}
+}
+
+func TestNewRegisteredMeteredWriter_CustomHistogram(t *testing.T) {
+	r := new(testRegistry)
+	var created int
+	newHistogram := func() Histogram {
+		created++
+		return NewBufferedHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)), 1)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := NewRegisteredMeteredWriter("writes", r, ioutil.Discard, newHistogram); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if created != 2 {
+		t.Fatal("histogram of custom type is not registered and should be created on each call, got:", created)
+	}
+}
+
+func (r *testRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.m, name)
+}
+
+func TestNewMeteredWriterNamed(t *testing.T) {
+	r := new(testRegistry)
+	newHistogram := func() Histogram { return metrics.NewHistogram(metrics.NewUniformSample(100)) }
+	kept, err := NewMeteredWriterNamed(r, "kept", ioutil.Discard, newHistogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := NewMeteredWriterNamed(r, "writes", ioutil.Discard, newHistogram, WithUnregister())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.Write([]byte("data"))
+	if h, ok := r.m["writes"].(Histogram); !ok || h.Count() != 1 {
+		t.Fatal("histogram should be registered under writer name")
+	}
+	mw.Close()
+	kept.Close()
+	if _, ok := r.m["writes"]; ok {
+		t.Fatal("histogram should be unregistered on Close")
+	}
+	if _, ok := r.m["kept"]; !ok {
+		t.Fatal("histogram should stay registered without WithUnregister option")
+	}
+}
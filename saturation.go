@@ -0,0 +1,93 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// SaturationWriter wraps io.Writer, limiting number of concurrent Write calls
+// to a fixed number of permits, and keeps track of how much time all permits
+// were taken. Write calls over the limit block until a permit is released.
+// Fraction of time spent saturated is a leading indicator of latency problems
+// that latency histograms alone do not show.
+type SaturationWriter struct {
+	io.Writer
+	permits chan struct{}
+	now     func() time.Time
+
+	mu        sync.Mutex
+	inUse     int
+	since     time.Time     // start of saturated period, if saturated
+	saturated time.Duration // saturated time accumulated in current window
+	window    time.Time     // current window start
+}
+
+// NewSaturationWriter returns SaturationWriter wrapping writer, which allows
+// up to n concurrent writes. n less than 1 is treated as 1.
+func NewSaturationWriter(writer io.Writer, n int) *SaturationWriter {
+	if n < 1 {
+		n = 1
+	}
+	w := &SaturationWriter{
+		Writer:  writer,
+		permits: make(chan struct{}, n),
+		now:     time.Now,
+	}
+	w.window = w.now()
+	return w
+}
+
+// Write implements io.Writer interface. It acquires a permit for the duration
+// of underlying Write call, blocking if all permits are taken.
+func (w *SaturationWriter) Write(p []byte) (n int, err error) {
+	w.permits <- struct{}{}
+	w.mu.Lock()
+	if w.inUse++; w.inUse == cap(w.permits) {
+		w.since = w.now()
+	}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		if w.inUse == cap(w.permits) {
+			w.saturated += w.now().Sub(w.since)
+		}
+		w.inUse--
+		w.mu.Unlock()
+		<-w.permits
+	}()
+	return w.Writer.Write(p)
+}
+
+// SaturationRatio returns fraction of time in [0, 1] range all permits were
+// taken since the previous SaturationRatio call (or since SaturationWriter
+// creation), and starts a new window.
+func (w *SaturationWriter) SaturationRatio() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	saturated := w.saturated
+	if w.inUse == cap(w.permits) {
+		saturated += now.Sub(w.since)
+		w.since = now
+	}
+	elapsed := now.Sub(w.window)
+	w.window, w.saturated = now, 0
+	if elapsed <= 0 {
+		return 0
+	}
+	ratio := float64(saturated) / float64(elapsed)
+	if ratio > 1 {
+		ratio = 1
+	}
+	return ratio
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it.
+func (w *SaturationWriter) Close() error {
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks each Write until a value is received on release.
+type blockingWriter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.started <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+func TestSaturationWriter(t *testing.T) {
+	clock := newFakeClock()
+	bw := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	w := NewSaturationWriter(bw, 2)
+	w.now = clock.Now
+	w.window = clock.Now()
+
+	clock.Advance(time.Second)
+	if r := w.SaturationRatio(); r != 0 {
+		t.Fatal("idle writer should not be saturated, got:", r)
+	}
+
+	done := make(chan struct{})
+	write := func() { w.Write([]byte("x")); done <- struct{}{} }
+	go write()
+	<-bw.started
+	clock.Advance(time.Second) // one permit taken: not saturated
+	go write()
+	<-bw.started
+	clock.Advance(3 * time.Second) // both permits taken
+	r := w.SaturationRatio()
+	t.Log("saturation ratio:", r)
+	if r != 0.75 {
+		t.Fatal("want saturation ratio 0.75, got:", r)
+	}
+	clock.Advance(time.Second) // still saturated over the whole new window
+	if r := w.SaturationRatio(); r != 1 {
+		t.Fatal("want saturation ratio 1, got:", r)
+	}
+	bw.release <- struct{}{}
+	<-done
+	clock.Advance(time.Second)
+	if r := w.SaturationRatio(); r != 0 {
+		t.Fatal("released writer should not be saturated, got:", r)
+	}
+	bw.release <- struct{}{}
+	<-done
+}
+
+func TestSaturationWriterSequential(t *testing.T) {
+	w := NewSaturationWriter(ioutil.Discard, 0)
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r := w.SaturationRatio(); r < 0 || r > 1 {
+		t.Fatal("saturation ratio out of range:", r)
+	}
+}
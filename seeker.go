@@ -0,0 +1,111 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// PositionMeteredWriter wraps io.WriteSeeker and samples write latency into
+// histograms selected by offset region the write started at, which reveals
+// positional latency patterns, e.g. slower writes near the end of file
+// triggering block allocation. Regions are of fixed size, with the last
+// region also covering all offsets past it.
+//
+// PositionMeteredWriter tracks current offset by adding number of bytes
+// written on each Write and by using result of each Seek call.
+type PositionMeteredWriter struct {
+	ws         io.WriteSeeker
+	regionSize int64
+	hs         []Histogram
+	now        func() time.Time
+
+	mu  sync.Mutex
+	off int64
+}
+
+// NewPositionMeteredWriter returns PositionMeteredWriter wrapping ws. Region i
+// covers offsets [i*regionSize, (i+1)*regionSize), samples of writes started
+// in region i are stored in hs[i]; nil histograms are skipped. If histograms
+// implement Registrar interface, this would also call their Register()
+// methods. Initial offset is obtained by calling ws.Seek(0, io.SeekCurrent);
+// zero offset is assumed if this call fails.
+func NewPositionMeteredWriter(ws io.WriteSeeker, regionSize int64, hs []Histogram) *PositionMeteredWriter {
+	if regionSize < 1 {
+		regionSize = 1
+	}
+	off, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		off = 0
+	}
+	register(hs...)
+	return &PositionMeteredWriter{
+		ws:         ws,
+		regionSize: regionSize,
+		hs:         hs,
+		off:        off,
+		now:        time.Now,
+	}
+}
+
+// Histograms returns per-region histograms.
+func (w *PositionMeteredWriter) Histograms() []Histogram {
+	return append([]Histogram(nil), w.hs...)
+}
+
+// Offset returns tracked current offset.
+func (w *PositionMeteredWriter) Offset() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.off
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled into histogram of region write started at. Samples are
+// stored in nanoseconds.
+func (w *PositionMeteredWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	h := w.histogram(w.off)
+	start := w.now()
+	n, err = w.ws.Write(p)
+	if n > 0 && h != nil {
+		h.Update(w.now().Sub(start).Nanoseconds())
+	}
+	w.off += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker interface, updating tracked offset; seeks are not
+// sampled.
+func (w *PositionMeteredWriter) Seek(offset int64, whence int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	off, err := w.ws.Seek(offset, whence)
+	if err == nil {
+		w.off = off
+	}
+	return off, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it. If attached histograms
+// implement Registrar interface, this would call their Done() methods.
+func (w *PositionMeteredWriter) Close() error {
+	done(w.hs...)
+	if c, ok := w.ws.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *PositionMeteredWriter) histogram(off int64) Histogram {
+	if len(w.hs) == 0 {
+		return nil
+	}
+	i := off / w.regionSize
+	if i >= int64(len(w.hs)) || i < 0 {
+		i = int64(len(w.hs) - 1)
+	}
+	return w.hs[i]
+}
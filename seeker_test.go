@@ -0,0 +1,49 @@
+package meteredwriter
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestPositionMeteredWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "meteredwriter-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	hs := []Histogram{
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+		metrics.NewHistogram(metrics.NewUniformSample(100)),
+	}
+	w := NewPositionMeteredWriter(f, 100, hs)
+	defer w.Close()
+	// region 0: two writes, the second one ending past region boundary
+	w.Write(make([]byte, 60))
+	w.Write(make([]byte, 60))
+	// region 1
+	w.Write(make([]byte, 10))
+	if off := w.Offset(); off != 130 {
+		t.Fatal("unexpected tracked offset:", off)
+	}
+	if _, err := w.Seek(1000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	// past the last region
+	w.Write(make([]byte, 10))
+	if _, err := w.Seek(-20, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	if off := w.Offset(); off != 990 {
+		t.Fatal("seek should update tracked offset, got:", off)
+	}
+	for i, want := range []int64{2, 1, 1} {
+		if cnt := hs[i].Count(); cnt != want {
+			t.Errorf("region %d: want %d samples, got %d", i, want, cnt)
+		}
+	}
+}
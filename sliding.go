@@ -0,0 +1,124 @@
+package meteredwriter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlidingWindowHistogram wraps Histogram, keeping only samples added during
+// the last window, so that percentiles reflect recent behavior under steady
+// load, whereas SelfCleaningHistogram only clears samples after a period of
+// inactivity. Old samples are discarded by a background goroutine checking
+// histogram slidingSteps times per window, so histogram may hold samples up
+// to window/slidingSteps older than window.
+//
+// Each sample added during window is kept in memory (16 bytes per sample) in
+// addition to wrapped histogram's own storage, and wrapped histogram is
+// rebuilt from kept samples on each discard, so under high throughput both
+// memory and CPU usage grow proportionally to write rate times window. Prefer
+// short windows for busy writers.
+type SlidingWindowHistogram struct {
+	Histogram
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	samples []timedSample // oldest first
+
+	q    chan struct{}
+	once sync.Once
+}
+
+type timedSample struct {
+	at int64 // unix nanoseconds
+	v  int64
+}
+
+// slidingSteps is a number of times per window SlidingWindowHistogram
+// discards old samples.
+const slidingSteps = 10
+
+// NewSlidingWindowHistogram returns SlidingWindowHistogram wrapping histogram,
+// keeping samples added during the last window; non-positive window is
+// treated as one minute. Call Shutdown to stop background goroutine once
+// histogram is no longer needed.
+func NewSlidingWindowHistogram(histogram Histogram, window time.Duration) *SlidingWindowHistogram {
+	if window <= 0 {
+		window = time.Minute
+	}
+	h := &SlidingWindowHistogram{
+		Histogram: histogram,
+		window:    window,
+		now:       time.Now,
+		q:         make(chan struct{}),
+	}
+	go h.run(window / slidingSteps)
+	return h
+}
+
+func (h *SlidingWindowHistogram) run(step time.Duration) {
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.expire()
+		case <-h.q:
+			return
+		}
+	}
+}
+
+// Update adds sample to histogram.
+func (h *SlidingWindowHistogram) Update(v int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Histogram.Update(v)
+	h.samples = append(h.samples, timedSample{at: h.now().UnixNano(), v: v})
+}
+
+// Clear clears histogram samples.
+func (h *SlidingWindowHistogram) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Histogram.Clear()
+	h.samples = h.samples[:0]
+}
+
+// Shutdown implements Registrar interface, it stops background goroutine and
+// forwards call to wrapped histogram if it implements Registrar; histogram
+// keeps samples it held, and they are no longer discarded. It is safe to call
+// Shutdown more than once.
+func (h *SlidingWindowHistogram) Shutdown() {
+	h.once.Do(func() {
+		close(h.q)
+		shutdownAll(h.Histogram)
+	})
+}
+
+// expire discards samples older than window, rebuilding wrapped histogram
+// from the rest.
+func (h *SlidingWindowHistogram) expire() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cutoff := h.now().Add(-h.window).UnixNano()
+	i := sort.Search(len(h.samples), func(i int) bool { return h.samples[i].at >= cutoff })
+	if i == 0 {
+		return
+	}
+	n := copy(h.samples, h.samples[i:])
+	h.samples = h.samples[:n]
+	h.Histogram.Clear()
+	for _, s := range h.samples {
+		h.Histogram.Update(s.v)
+	}
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *SlidingWindowHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *SlidingWindowHistogram) Done() { done(h.Histogram) }
@@ -0,0 +1,48 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestSlidingWindowHistogram(t *testing.T) {
+	clock := newFakeClock()
+	h := NewSlidingWindowHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)), time.Hour)
+	defer h.Shutdown()
+	h.now = clock.Now
+	h.Update(1000)
+	clock.Advance(40 * time.Minute)
+	h.Update(10)
+	h.Update(20)
+	clock.Advance(30 * time.Minute)
+	h.expire()
+	if cnt := h.Count(); cnt != 2 {
+		t.Fatal("sample older than window should be discarded, got samples:", cnt)
+	}
+	if max := h.Max(); max != 20 {
+		t.Fatal("percentiles should only reflect samples within window, got max:", max)
+	}
+	clock.Advance(time.Hour)
+	h.expire()
+	if cnt := h.Count(); cnt != 0 {
+		t.Fatal("all samples should be discarded, got:", cnt)
+	}
+	h.Shutdown()
+}
+
+func TestSlidingWindowHistogram_Background(t *testing.T) {
+	h := NewSlidingWindowHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)),
+		50*time.Millisecond)
+	defer h.Shutdown()
+	h.Update(1)
+	time.Sleep(150 * time.Millisecond)
+	if cnt := h.Count(); cnt != 0 {
+		t.Fatal("old samples should be discarded by background goroutine, got:", cnt)
+	}
+}
+
+func TestSlidingWindowHistogram_Registrar(t *testing.T) {
+	testRegistrarForwarding(t, func(h Histogram) Histogram { return NewSlidingWindowHistogram(h, time.Hour) })
+}
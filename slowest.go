@@ -0,0 +1,145 @@
+package meteredwriter
+
+import (
+	"container/heap"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxSlowWrites is the upper bound on the number of writes SlowestWriter keeps
+// per window.
+const MaxSlowWrites = 1000
+
+// SlowWrite describes a single write operation reported by SlowestWriter.
+type SlowWrite struct {
+	Time     time.Time     // time write started
+	Duration time.Duration // write latency
+	Bytes    int           // number of bytes written
+}
+
+// SlowestWriter wraps io.Writer and keeps track of the slowest non-empty write
+// operations over a fixed time window. Once window passes, collected writes are
+// handed to report function, slowest first, and a new window starts. Report
+// function is called at most once per window, so it can be used to log slow
+// writes without flooding logs.
+//
+// Window is only rolled over on Write, so report for the last window is
+// delayed until the next write or Close call.
+type SlowestWriter struct {
+	io.Writer
+	report func([]SlowWrite)
+	window time.Duration
+	size   int
+	now    func() time.Time
+
+	mu    sync.Mutex
+	start time.Time // current window start
+	top   slowHeap
+}
+
+// NewSlowestWriter returns SlowestWriter wrapping writer, which keeps up to n
+// slowest writes for each window and calls report with them on window roll. n
+// is clamped to [1, MaxSlowWrites] range; non-positive window is treated as
+// one minute.
+func NewSlowestWriter(writer io.Writer, n int, window time.Duration, report func([]SlowWrite)) *SlowestWriter {
+	switch {
+	case n < 1:
+		n = 1
+	case n > MaxSlowWrites:
+		n = MaxSlowWrites
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &SlowestWriter{
+		Writer: writer,
+		report: report,
+		window: window,
+		size:   n,
+		now:    time.Now,
+	}
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and kept if it is one of the slowest in the current window.
+func (w *SlowestWriter) Write(p []byte) (n int, err error) {
+	start := w.now()
+	n, err = w.Writer.Write(p)
+	if n > 0 {
+		w.add(SlowWrite{Time: start, Duration: w.now().Sub(start), Bytes: n})
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. It reports writes collected in the
+// current window, if any. If underlying writer implements io.Closer, calling
+// this method would also close it.
+func (w *SlowestWriter) Close() error {
+	w.mu.Lock()
+	writes := w.drain()
+	w.mu.Unlock()
+	w.emit(writes)
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *SlowestWriter) add(s SlowWrite) {
+	var writes []SlowWrite
+	w.mu.Lock()
+	if w.start.IsZero() {
+		w.start = s.Time
+	}
+	if s.Time.Sub(w.start) >= w.window {
+		writes = w.drain()
+		w.start = s.Time
+	}
+	switch {
+	case len(w.top) < w.size:
+		heap.Push(&w.top, s)
+	case s.Duration > w.top[0].Duration:
+		w.top[0] = s
+		heap.Fix(&w.top, 0)
+	}
+	w.mu.Unlock()
+	w.emit(writes)
+}
+
+// drain empties heap returning its items sorted slowest first. Must be called
+// with mu held.
+func (w *SlowestWriter) drain() []SlowWrite {
+	if len(w.top) == 0 {
+		return nil
+	}
+	writes := make([]SlowWrite, len(w.top))
+	copy(writes, w.top)
+	w.top = w.top[:0]
+	sort.Slice(writes, func(i, j int) bool {
+		return writes[i].Duration > writes[j].Duration
+	})
+	return writes
+}
+
+func (w *SlowestWriter) emit(writes []SlowWrite) {
+	if len(writes) > 0 && w.report != nil {
+		w.report(writes)
+	}
+}
+
+// slowHeap is a min-heap of writes ordered by duration, so the fastest of kept
+// writes is always on top and can be replaced by a slower one.
+type slowHeap []SlowWrite
+
+func (h slowHeap) Len() int            { return len(h) }
+func (h slowHeap) Less(i, j int) bool  { return h[i].Duration < h[j].Duration }
+func (h slowHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *slowHeap) Push(x interface{}) { *h = append(*h, x.(SlowWrite)) }
+func (h *slowHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,66 @@
+package meteredwriter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowestWriter(t *testing.T) {
+	clock := newFakeClock()
+	var delays []time.Duration
+	for i := 1; i <= 20; i++ {
+		delays = append(delays, time.Duration((i*7)%20+1)*time.Millisecond)
+	}
+	var reports [][]SlowWrite
+	w := NewSlowestWriter(&slowWriter{clock: clock, delays: delays}, 3,
+		time.Hour, func(s []SlowWrite) { reports = append(reports, s) })
+	w.now = clock.Now
+	for range delays {
+		if _, err := w.Write([]byte("data")); err != nil {
+			t.Fatal("write error:", err)
+		}
+	}
+	if len(reports) != 0 {
+		t.Fatal("nothing should be reported before window ends, got:", reports)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("close error:", err)
+	}
+	if len(reports) != 1 {
+		t.Fatal("expected exactly one report, got:", len(reports))
+	}
+	want := []time.Duration{20 * time.Millisecond, 19 * time.Millisecond, 18 * time.Millisecond}
+	got := reports[0]
+	if len(got) != len(want) {
+		t.Fatalf("expected %d slow writes, got %d", len(want), len(got))
+	}
+	for i, s := range got {
+		t.Logf("slow write: %s, %d bytes at %s", s.Duration, s.Bytes, s.Time)
+		if s.Duration != want[i] || s.Bytes != 4 {
+			t.Fatalf("slow write #%d: want %s, got %s (%d bytes)", i, want[i], s.Duration, s.Bytes)
+		}
+	}
+}
+
+func TestSlowestWriter_WindowRoll(t *testing.T) {
+	clock := newFakeClock()
+	var reports [][]SlowWrite
+	w := NewSlowestWriter(&slowWriter{clock: clock, delays: []time.Duration{time.Millisecond}},
+		2, time.Second, func(s []SlowWrite) { reports = append(reports, s) })
+	w.now = clock.Now
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("x"))
+	}
+	clock.Advance(time.Second)
+	w.Write([]byte("y"))
+	if len(reports) != 1 {
+		t.Fatal("window roll should produce exactly one report, got:", len(reports))
+	}
+	if n := len(reports[0]); n != 2 {
+		t.Fatal("report should be bounded to 2 writes, got:", n)
+	}
+	w.Close()
+	if len(reports) != 2 || len(reports[1]) != 1 || reports[1][0].Bytes != 1 {
+		t.Fatal("close should report write from the second window, got:", reports)
+	}
+}
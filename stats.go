@@ -0,0 +1,73 @@
+package meteredwriter
+
+import "time"
+
+// Stats holds histogram statistics captured at some point in time. It has no
+// references to the histogram it was captured from.
+type Stats struct {
+	Count                  int64
+	Min, Max               int64
+	Mean, StdDev, Variance float64
+	// 50th, 75th, 90th, 95th, 99th and 99.9th percentiles
+	P50, P75, P90, P95, P99, P999 float64
+}
+
+// Scale returns statistics of samples in given unit converted to
+// nanoseconds, e.g. Scale(time.Microsecond) multiplies values by 1000. Unit
+// less than or equal to one nanosecond returns s unchanged.
+func (s Stats) Scale(unit time.Duration) Stats {
+	if unit <= time.Nanosecond {
+		return s
+	}
+	k := float64(unit)
+	s.Min *= int64(unit)
+	s.Max *= int64(unit)
+	s.Mean *= k
+	s.StdDev *= k
+	s.Variance *= k * k
+	s.P50 *= k
+	s.P75 *= k
+	s.P90 *= k
+	s.P95 *= k
+	s.P99 *= k
+	s.P999 *= k
+	return s
+}
+
+// Snapshotter is implemented by histograms which can capture their statistics
+// consistently, with no samples added between reading individual values.
+type Snapshotter interface {
+	Snapshot() Stats
+}
+
+// Snapshot captures statistics of h into a plain struct which is safe to hand
+// over to another goroutine. If h implements Snapshotter interface, its
+// Snapshot method is used, so that captured values are consistent. Otherwise
+// values are read one by one and may not be consistent if h is updated
+// concurrently; wrap such histograms with TumblingHistogram to get consistent
+// snapshots.
+func Snapshot(h Histogram) Stats {
+	if s, ok := h.(Snapshotter); ok {
+		return s.Snapshot()
+	}
+	return snapshot(h)
+}
+
+// snapshot reads statistics of h one by one.
+func snapshot(h Histogram) Stats {
+	ps := h.Percentiles([]float64{0.5, 0.75, 0.9, 0.95, 0.99, 0.999})
+	return Stats{
+		Count:    h.Count(),
+		Min:      h.Min(),
+		Max:      h.Max(),
+		Mean:     h.Mean(),
+		StdDev:   h.StdDev(),
+		Variance: h.Variance(),
+		P50:      ps[0],
+		P75:      ps[1],
+		P90:      ps[2],
+		P95:      ps[3],
+		P99:      ps[4],
+		P999:     ps[5],
+	}
+}
@@ -0,0 +1,30 @@
+package meteredwriter
+
+import (
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestSnapshot(t *testing.T) {
+	h := metrics.NewHistogram(metrics.NewUniformSample(1000))
+	for i := int64(1); i <= 100; i++ {
+		h.Update(i)
+	}
+	s := Snapshot(h)
+	t.Logf("%+v", s)
+	if s.Count != 100 || s.Min != 1 || s.Max != 100 || s.Mean != 50.5 {
+		t.Fatalf("unexpected snapshot: %+v", s)
+	}
+	if s.P50 < 50 || s.P50 > 51 || s.P99 < 99 {
+		t.Fatalf("unexpected percentiles: %+v", s)
+	}
+	h.Update(1000)
+	if s.Count != 100 || s.Max != 100 {
+		t.Fatal("snapshot should not change after histogram update")
+	}
+	th := NewTumblingHistogram(h)
+	if s := Snapshot(th); s.Count != 101 || s.Max != 1000 {
+		t.Fatalf("unexpected snapshot of tumbling histogram: %+v", s)
+	}
+}
@@ -0,0 +1,89 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SwappableMeteredWriter is a MeteredWriter whose histogram can be replaced
+// while it is in use, e.g. on configuration reload, without recreating writer
+// and losing underlying connection. It is safe for concurrent use if
+// underlying writer is.
+type SwappableMeteredWriter struct {
+	io.Writer
+	h atomic.Value // histogramBox
+
+	mu     sync.Mutex // serializes SetHistogram and Close
+	closed bool
+}
+
+// histogramBox allows storing nil Histogram in atomic.Value.
+type histogramBox struct{ h Histogram }
+
+// NewSwappableMeteredWriter attaches provided histogram to writer as
+// NewMeteredWriter does; h may be nil. If histogram implements Registrar
+// interface, this would also call its Register() method.
+func NewSwappableMeteredWriter(writer io.Writer, h Histogram) *SwappableMeteredWriter {
+	w := &SwappableMeteredWriter{Writer: writer}
+	register(h)
+	w.h.Store(histogramBox{h})
+	return w
+}
+
+// Histogram returns currently attached histogram.
+func (w *SwappableMeteredWriter) Histogram() Histogram {
+	return w.h.Load().(histogramBox).h
+}
+
+// SetHistogram atomically replaces attached histogram with h, which may be
+// nil. If new histogram implements Registrar interface, its Register() method
+// is called before it is attached; Done() method of old one is called after
+// it is detached. Writes which are in progress during the swap may still
+// sample their latency to old histogram. SetHistogram called after Close only
+// attaches h, without registering it.
+func (w *SwappableMeteredWriter) SetHistogram(h Histogram) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		w.h.Store(histogramBox{h})
+		return
+	}
+	register(h)
+	old := w.h.Load().(histogramBox).h
+	w.h.Store(histogramBox{h})
+	done(old)
+}
+
+// Write implements io.Writer interface; each non-empty write operation is
+// timed and sampled in currently attached histogram. Samples are stored in
+// nanoseconds.
+func (w *SwappableMeteredWriter) Write(p []byte) (n int, err error) {
+	h := w.Histogram()
+	if h == nil {
+		return w.Writer.Write(p)
+	}
+	start := time.Now()
+	n, err = w.Writer.Write(p)
+	if n > 0 {
+		h.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it. If attached histogram
+// also implements Registrar interface, this would call its Done() method once.
+func (w *SwappableMeteredWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		done(w.Histogram())
+	}
+	w.mu.Unlock()
+	if c, ok := w.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
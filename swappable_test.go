@@ -0,0 +1,57 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestSwappableMeteredWriter(t *testing.T) {
+	h1 := &registrarHistogram{Histogram: metrics.NewHistogram(metrics.NewUniformSample(100))}
+	h2 := &registrarHistogram{Histogram: metrics.NewHistogram(metrics.NewUniformSample(100))}
+	w := NewSwappableMeteredWriter(ioutil.Discard, h1)
+	w.Write([]byte("data"))
+	w.SetHistogram(h2)
+	w.Write([]byte("data"))
+	w.Write([]byte("data"))
+	if h1.Count() != 1 || h2.Count() != 2 {
+		t.Fatalf("samples should land in new histogram, got %d old and %d new", h1.Count(), h2.Count())
+	}
+	if h1.registered != 1 || h1.done != 1 || h2.registered != 1 || h2.done != 0 {
+		t.Fatal("old histogram should be released and new one registered")
+	}
+	w.Close()
+	w.Close()
+	if h2.done != 1 {
+		t.Fatal("current histogram should be released on Close once, got:", h2.done)
+	}
+	w.SetHistogram(nil)
+	w.Write([]byte("data"))
+}
+
+// TestSwappableMeteredWriter_Concurrent is mostly useful with -race flag.
+func TestSwappableMeteredWriter_Concurrent(t *testing.T) {
+	const writes = 1000
+	hs := []Histogram{
+		metrics.NewHistogram(metrics.NewUniformSample(writes)),
+		metrics.NewHistogram(metrics.NewUniformSample(writes)),
+	}
+	w := NewSwappableMeteredWriter(ioutil.Discard, hs[0])
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			w.Write([]byte("data"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		w.SetHistogram(hs[i%2])
+	}
+	wg.Wait()
+	if total := hs[0].Count() + hs[1].Count(); total != writes {
+		t.Fatalf("want %d samples in total, got %d", writes, total)
+	}
+}
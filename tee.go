@@ -0,0 +1,90 @@
+package meteredwriter
+
+import (
+	"io"
+	"sync"
+)
+
+// TeeWriter writes data to primary writer synchronously and mirrors it to a
+// secondary writer, like an audit log, asynchronously, so that slow secondary
+// writer does not affect primary path. Latency of secondary writes is sampled
+// to attached histogram. Mirrored writes are queued in a buffer of fixed size;
+// if it is full, write is not mirrored and dropped counter is incremented.
+type TeeWriter struct {
+	primary   io.Writer
+	secondary MeteredWriter
+	dropped   Counter
+
+	mu     sync.RWMutex // guards queue against send on closed channel
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+}
+
+// NewTeeWriter returns TeeWriter writing to primary and mirroring writes to
+// secondary with up to buffer writes queued. Latency of secondary writes is
+// sampled to h as NewMeteredWriter does; dropped counter may be nil. Errors of
+// secondary writes are ignored.
+func NewTeeWriter(primary, secondary io.Writer, h Histogram, buffer int, dropped Counter) *TeeWriter {
+	w := &TeeWriter{
+		primary:   primary,
+		secondary: NewMeteredWriter(secondary, h),
+		dropped:   dropped,
+		queue:     make(chan []byte, buffer),
+		done:      make(chan struct{}),
+	}
+	go w.mirror()
+	return w
+}
+
+func (w *TeeWriter) mirror() {
+	defer close(w.done)
+	for p := range w.queue {
+		w.secondary.Write(p)
+	}
+}
+
+// Write implements io.Writer interface, writing p to primary writer and
+// queueing bytes accepted by it for secondary writer.
+func (w *TeeWriter) Write(p []byte) (n int, err error) {
+	n, err = w.primary.Write(p)
+	if n == 0 {
+		return n, err
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return n, err
+	}
+	select {
+	case w.queue <- append([]byte(nil), p[:n]...):
+	default:
+		if w.dropped != nil {
+			w.dropped.Inc(1)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. It waits for queued writes to be
+// mirrored, then closes secondary and primary writers if they implement
+// io.Closer, returning the first error. If attached histogram implements
+// Registrar interface, this would call its Done() method.
+func (w *TeeWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+	<-w.done
+	err := w.secondary.Close()
+	if c, ok := w.primary.(io.Closer); ok {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestTeeWriter(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	primary, secondary := new(bytes.Buffer), new(bytes.Buffer)
+	dropped := new(testCounter)
+	w := NewTeeWriter(primary, secondary, histogram, 10, dropped)
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write([]byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if primary.String() != secondary.String() || primary.Len() != 20 {
+		t.Fatalf("unexpected content: primary %q, secondary %q", primary, secondary)
+	}
+	if cnt := histogram.Count(); cnt != 5 {
+		t.Fatal("should have 5 registered samples, got:", cnt)
+	}
+	if cnt := dropped.Count(); cnt != 0 {
+		t.Fatal("no writes should be dropped, got:", cnt)
+	}
+}
+
+func TestTeeWriter_Dropped(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	bw := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	primary := new(bytes.Buffer)
+	dropped := new(testCounter)
+	w := NewTeeWriter(primary, bw, histogram, 2, dropped)
+	w.Write([]byte("data"))
+	<-bw.started // mirror goroutine is blocked on the first write
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("data"))
+	}
+	if primary.Len() != 24 {
+		t.Fatal("primary writes should not be affected, got bytes:", primary.Len())
+	}
+	if cnt := dropped.Count(); cnt != 3 {
+		t.Fatal("want 3 dropped writes, got:", cnt)
+	}
+	go func() {
+		for range bw.started {
+		}
+	}()
+	close(bw.release)
+	w.Close()
+	close(bw.started)
+	if cnt := histogram.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+}
@@ -0,0 +1,39 @@
+package meteredwriter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WriteToken tracks a single asynchronous write operation started with
+// MeteredWriter.BeginWrite.
+type WriteToken struct {
+	mw    MeteredWriter
+	start time.Time
+	timed bool
+	done  int32 // set atomically on completion
+}
+
+// BeginWrite starts timing a write operation which completes after the
+// underlying writer returns, e.g. for fire-and-forget writers completing I/O
+// in a callback. Call Complete method of returned token once the actual I/O
+// finishes to sample its true latency.
+//
+// Token that is never completed is never sampled, so its timing is lost;
+// callers should bound the number of outstanding tokens, e.g. by completing
+// them with an error on timeout.
+func (mw MeteredWriter) BeginWrite() *WriteToken {
+	start, timed := mw.begin()
+	return &WriteToken{mw: mw, start: start, timed: timed}
+}
+
+// Complete finishes write operation that wrote n bytes and returned err,
+// sampling its latency the same way MeteredWriter.Write does. Only the first
+// call of Complete has effect, subsequent calls are no-op.
+func (t *WriteToken) Complete(n int, err error) {
+	if !atomic.CompareAndSwapInt32(&t.done, 0, 1) {
+		return
+	}
+	t.mw.leave()
+	t.mw.end(t.start, t.timed, n, n, err, false)
+}
@@ -0,0 +1,35 @@
+package meteredwriter
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredWriter_BeginWrite(t *testing.T) {
+	clock := newFakeClock()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	mw := NewMeteredWriter(ioutil.Discard, histogram, WithClock(clock.Now))
+	t1 := mw.BeginWrite()
+	t2 := mw.BeginWrite()
+	clock.Advance(5 * time.Millisecond)
+	t1.Complete(10, nil)
+	t1.Complete(10, nil)
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("token should be sampled only once, got:", cnt)
+	}
+	if v := histogram.Max(); v != (5 * time.Millisecond).Nanoseconds() {
+		t.Fatal("unexpected sample value:", time.Duration(v))
+	}
+	clock.Advance(10 * time.Millisecond)
+	t2.Complete(10, nil)
+	if v := histogram.Max(); v != (15 * time.Millisecond).Nanoseconds() {
+		t.Fatal("delayed completion should be sampled with its true latency, got:", time.Duration(v))
+	}
+	mw.BeginWrite().Complete(0, nil)
+	if cnt := histogram.Count(); cnt != 2 {
+		t.Fatal("empty writes should not be sampled, got:", cnt)
+	}
+}
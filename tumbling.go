@@ -0,0 +1,63 @@
+package meteredwriter
+
+import "sync"
+
+// TumblingHistogram wraps Histogram for tumbling-window aggregation: each
+// SnapshotAndClear call captures histogram statistics and clears it in one
+// critical section, so consecutive windows are disjoint and no sample is lost
+// or counted twice. Unlike SelfCleaningHistogram, window boundaries are
+// defined by the consumer calling SnapshotAndClear.
+type TumblingHistogram struct {
+	Histogram
+	mu sync.RWMutex
+}
+
+// NewTumblingHistogram returns TumblingHistogram wrapping histogram.
+func NewTumblingHistogram(histogram Histogram) *TumblingHistogram {
+	return &TumblingHistogram{Histogram: histogram}
+}
+
+// Update adds sample to histogram. Concurrent Update calls do not block each
+// other, but wait for SnapshotAndClear to finish.
+func (h *TumblingHistogram) Update(v int64) {
+	h.mu.RLock()
+	h.Histogram.Update(v)
+	h.mu.RUnlock()
+}
+
+// Clear clears histogram samples.
+func (h *TumblingHistogram) Clear() {
+	h.mu.Lock()
+	h.Histogram.Clear()
+	h.mu.Unlock()
+}
+
+// Snapshot implements Snapshotter interface, returning histogram statistics
+// with no concurrent updates in between reading individual values.
+func (h *TumblingHistogram) Snapshot() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return snapshot(h.Histogram)
+}
+
+// SnapshotAndClear returns histogram statistics and clears it; samples added
+// concurrently are reflected by either this or the next window.
+func (h *TumblingHistogram) SnapshotAndClear() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := snapshot(h.Histogram)
+	h.Histogram.Clear()
+	return s
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *TumblingHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *TumblingHistogram) Done() { done(h.Histogram) }
+
+// Shutdown implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *TumblingHistogram) Shutdown() { shutdownAll(h.Histogram) }
@@ -0,0 +1,49 @@
+package meteredwriter
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestTumblingHistogram(t *testing.T) {
+	const writers, updates = 4, 2000
+	h := NewTumblingHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)))
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				h.Update(int64(j))
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() { wg.Wait(); close(finished) }()
+	var total, windows int64
+scrape:
+	for {
+		select {
+		case <-finished:
+			break scrape
+		default:
+			s := h.SnapshotAndClear()
+			total += s.Count
+			windows++
+		}
+	}
+	total += h.SnapshotAndClear().Count
+	t.Logf("%d windows", windows)
+	if total != writers*updates {
+		t.Fatalf("windows should add up to %d samples, got %d", writers*updates, total)
+	}
+	if cnt := h.Count(); cnt != 0 {
+		t.Fatal("histogram should be empty after snapshot, got:", cnt)
+	}
+}
+
+func TestTumblingHistogram_Registrar(t *testing.T) {
+	testRegistrarForwarding(t, func(h Histogram) Histogram { return NewTumblingHistogram(h) })
+}
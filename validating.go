@@ -0,0 +1,58 @@
+package meteredwriter
+
+import "math"
+
+// ValidatingHistogram wraps Histogram rejecting invalid samples: negative
+// values, and NaN, infinite or out of range values passed through UpdateFloat.
+// Rejected samples are not added to histogram, instead they increment
+// rejection counter, which helps to catch bugs in custom sinks and adapters
+// without polluting the distribution. Other methods are passed to wrapped
+// histogram, including Registrar ones if wrapped histogram implements it.
+type ValidatingHistogram struct {
+	Histogram
+	rejected Counter
+}
+
+// NewValidatingHistogram returns ValidatingHistogram wrapping histogram;
+// rejected samples increment rejected counter, which may be nil.
+func NewValidatingHistogram(histogram Histogram, rejected Counter) *ValidatingHistogram {
+	return &ValidatingHistogram{Histogram: histogram, rejected: rejected}
+}
+
+// Update adds non-negative sample to histogram, rejecting negative ones.
+func (h *ValidatingHistogram) Update(v int64) {
+	if v < 0 {
+		h.reject()
+		return
+	}
+	h.Histogram.Update(v)
+}
+
+// UpdateFloat adds sample converted from float64 to histogram, rejecting
+// negative, NaN, infinite values and values not representable as int64.
+// Fractional part is truncated.
+func (h *ValidatingHistogram) UpdateFloat(v float64) {
+	if math.IsNaN(v) || v < 0 || v >= math.MaxInt64 {
+		h.reject()
+		return
+	}
+	h.Histogram.Update(int64(v))
+}
+
+func (h *ValidatingHistogram) reject() {
+	if h.rejected != nil {
+		h.rejected.Inc(1)
+	}
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *ValidatingHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *ValidatingHistogram) Done() { done(h.Histogram) }
+
+// Shutdown implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *ValidatingHistogram) Shutdown() { shutdownAll(h.Histogram) }
@@ -0,0 +1,34 @@
+package meteredwriter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestValidatingHistogram(t *testing.T) {
+	rejected := new(testCounter)
+	h := NewValidatingHistogram(metrics.NewHistogram(metrics.NewUniformSample(100)), rejected)
+	h.Update(100)
+	h.Update(0)
+	h.Update(-1)
+	h.Update(math.MinInt64)
+	h.UpdateFloat(50.7)
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), -0.5, 1e19} {
+		h.UpdateFloat(v)
+	}
+	if cnt := h.Count(); cnt != 3 {
+		t.Fatal("should have 3 registered samples, got:", cnt)
+	}
+	if cnt := rejected.Count(); cnt != 7 {
+		t.Fatal("should have 7 rejected samples, got:", cnt)
+	}
+	if min, max := h.Min(), h.Max(); min != 0 || max != 100 {
+		t.Fatalf("rejected samples leaked into histogram: min %d, max %d", min, max)
+	}
+}
+
+func TestValidatingHistogram_Registrar(t *testing.T) {
+	testRegistrarForwarding(t, func(h Histogram) Histogram { return NewValidatingHistogram(h, nil) })
+}
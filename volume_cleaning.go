@@ -0,0 +1,54 @@
+package meteredwriter
+
+import "sync"
+
+// VolumeCleaningHistogram wraps Histogram clearing its samples each time a
+// fixed number of samples was added since the previous clear, so it always
+// describes the latest batch of at most that many samples regardless of how
+// much time it took to collect them.
+type VolumeCleaningHistogram struct {
+	Histogram
+	limit int64
+
+	mu   sync.Mutex
+	seen int64 // samples added since last clear
+}
+
+// NewVolumeCleaningHistogram returns VolumeCleaningHistogram wrapping
+// histogram, which is cleared before adding a sample once limit samples were
+// added since the last clear. Non-positive limit disables cleaning.
+func NewVolumeCleaningHistogram(histogram Histogram, limit int64) *VolumeCleaningHistogram {
+	return &VolumeCleaningHistogram{Histogram: histogram, limit: limit}
+}
+
+// Update adds sample to histogram, clearing it first if limit was reached.
+func (h *VolumeCleaningHistogram) Update(v int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.limit > 0 && h.seen >= h.limit {
+		h.Histogram.Clear()
+		h.seen = 0
+	}
+	h.seen++
+	h.Histogram.Update(v)
+}
+
+// Clear clears histogram samples and resets volume counter.
+func (h *VolumeCleaningHistogram) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Histogram.Clear()
+	h.seen = 0
+}
+
+// Register implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *VolumeCleaningHistogram) Register() { register(h.Histogram) }
+
+// Done implements Registrar interface, forwarding call to wrapped histogram if
+// it implements Registrar.
+func (h *VolumeCleaningHistogram) Done() { done(h.Histogram) }
+
+// Shutdown implements Registrar interface, forwarding call to wrapped
+// histogram if it implements Registrar.
+func (h *VolumeCleaningHistogram) Shutdown() { shutdownAll(h.Histogram) }
@@ -0,0 +1,50 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// MeteredWriterAt wraps io.WriterAt and registers each positioned write
+// operation latency in attached histogram. It is safe for concurrent use if
+// underlying writer and histogram are, as it has no mutable state of its own.
+type MeteredWriterAt struct {
+	io.WriterAt
+	h Histogram
+}
+
+// NewMeteredWriterAt attaches provided histogram to writer, returning new
+// io.WriterAt. If histogram implements Registrar interface, this would also
+// call its Register() method.
+func NewMeteredWriterAt(writer io.WriterAt, h Histogram) MeteredWriterAt {
+	register(h)
+	return MeteredWriterAt{
+		WriterAt: writer,
+		h:        h,
+	}
+}
+
+// WriteAt implements io.WriterAt interface; each non-empty write operation is
+// timed and sampled in attached histogram. Samples are stored in nanoseconds.
+func (mw MeteredWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
+	var start time.Time
+	if mw.h != nil {
+		start = time.Now()
+	}
+	n, err = mw.WriterAt.WriteAt(p, off)
+	if n > 0 && mw.h != nil {
+		mw.h.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface. If underlying writer implements
+// io.Closer, calling this method would also close it. If attached histogram
+// also implements Registrar interface, this would call its Done() method.
+func (mw MeteredWriterAt) Close() error {
+	done(mw.h)
+	if c, ok := mw.WriterAt.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredWriterAt(t *testing.T) {
+	const chunks, chunkSize = 32, 1 << 10
+	f, err := ioutil.TempFile("", "meteredwriter-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	histogram := NewSelfCleaningHistogram(
+		metrics.NewHistogram(metrics.NewUniformSample(100)), time.Minute)
+	defer histogram.Shutdown()
+	mw := NewMeteredWriterAt(f, histogram)
+	var wg sync.WaitGroup
+	for i := 0; i < chunks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chunk := bytes.Repeat([]byte{byte(i)}, chunkSize)
+			if _, err := mw.WriteAt(chunk, int64(i*chunkSize)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cnt := histogram.Count(); cnt != chunks {
+		t.Fatalf("want %d samples, got %d", chunks, cnt)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < chunks; i++ {
+		if data[i*chunkSize] != byte(i) {
+			t.Fatal("unexpected data at chunk", i)
+		}
+	}
+}
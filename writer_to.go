@@ -0,0 +1,36 @@
+package meteredwriter
+
+import (
+	"io"
+	"time"
+)
+
+// MeteredWriterTo wraps io.WriterTo, like *bytes.Buffer, sampling duration of
+// each WriteTo call as a single sample, which instruments buffer drains; this
+// is the counterpart of MeteredWriter.ReadFrom.
+type MeteredWriterTo struct {
+	io.WriterTo
+	h     Histogram
+	bytes Counter
+}
+
+// NewMeteredWriterTo attaches provided histogram and bytes counter to wt;
+// either of them may be nil. Register and Done methods of h are not called.
+func NewMeteredWriterTo(wt io.WriterTo, h Histogram, bytes Counter) MeteredWriterTo {
+	return MeteredWriterTo{WriterTo: wt, h: h, bytes: bytes}
+}
+
+// WriteTo implements io.WriterTo interface, calling underlying WriteTo method;
+// its duration is sampled to histogram and number of bytes written is added
+// to counter, unless nothing was written. Samples are stored in nanoseconds.
+func (mw MeteredWriterTo) WriteTo(w io.Writer) (n int64, err error) {
+	start := time.Now()
+	n, err = mw.WriterTo.WriteTo(w)
+	if n > 0 && mw.h != nil {
+		mw.h.Update(time.Now().Sub(start).Nanoseconds())
+	}
+	if n > 0 && mw.bytes != nil {
+		mw.bytes.Inc(n)
+	}
+	return n, err
+}
@@ -0,0 +1,28 @@
+package meteredwriter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/artyom/metrics"
+)
+
+func TestMeteredWriterTo(t *testing.T) {
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	written := new(testCounter)
+	src := bytes.NewBufferString("some data")
+	dst := new(bytes.Buffer)
+	if n, err := NewMeteredWriterTo(src, histogram, written).WriteTo(dst); n != 9 || err != nil {
+		t.Fatalf("copy failed: %d, %v", n, err)
+	}
+	if dst.String() != "some data" {
+		t.Fatal("unexpected data copied:", dst.String())
+	}
+	if histogram.Count() != 1 || written.Count() != 9 {
+		t.Fatalf("want 1 sample and 9 bytes, got %d and %d", histogram.Count(), written.Count())
+	}
+	NewMeteredWriterTo(src, histogram, nil).WriteTo(dst) // drained buffer
+	if cnt := histogram.Count(); cnt != 1 {
+		t.Fatal("empty drain should not be sampled, got samples:", cnt)
+	}
+}